@@ -0,0 +1,109 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/config"
+	"github.com/ailinykh/waitlist/internal/repository"
+)
+
+const exportUsage = `usage: waitlist entries export [flags]`
+
+// exportCommand prints the waitlist entries to stdout, optionally only the ones of the given bots
+func exportCommand(args []string) int {
+	format := "csv"
+	bots := []string{}
+	cfg := loadConfig(args, (*config.Config).ValidateDatabase, func(fs *flag.FlagSet) {
+		fs.StringVar(&format, "format", format, "csv or json")
+		fs.Func("bot", "only export entries of the bot `username`, may be repeated", func(s string) error {
+			bots = append(bots, s)
+			return nil
+		})
+	})
+
+	if len(cfg.Args()) > 0 || (format != "csv" && format != "json") {
+		fmt.Fprintln(os.Stderr, exportUsage)
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	logger := NewLogger(cfg)
+	conn, err := db(logger, cfg, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+
+	repo := repository.New(conn)
+	var entries []repository.WaitlistEntry
+	if len(bots) > 0 {
+		entries, err = repo.GetEntriesByBotUsernames(ctx, bots)
+	} else {
+		entries, err = repo.GetAllEntries(ctx)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if err := writeEntries(os.Stdout, entries, format); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func writeEntries(w io.Writer, entries []repository.WaitlistEntry, format string) error {
+	if format == "json" {
+		if entries == nil {
+			entries = []repository.WaitlistEntry{}
+		}
+		encoder := json.NewEncoder(w)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(entries)
+	}
+
+	writer := csv.NewWriter(w)
+	_ = writer.Write([]string{
+		"id", "user_id", "first_name", "last_name", "username", "bot_username",
+		"message", "created_at", "updated_at", "flagged", "flag_reason",
+	})
+	for _, e := range entries {
+		_ = writer.Write([]string{
+			e.ID.String(),
+			strconv.FormatInt(e.UserID, 10),
+			csvText(e.FirstName),
+			csvText(e.LastName),
+			csvText(e.Username),
+			csvText(e.BotUsername),
+			csvText(e.Message),
+			e.CreatedAt.Format(time.RFC3339),
+			e.UpdatedAt.Format(time.RFC3339),
+			strconv.FormatBool(e.Flagged),
+			csvText(e.FlagReason),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvText keeps spreadsheets from evaluating the text users sent as a formula, e.g. `=HYPERLINK(...)`
+func csvText(s string) string {
+	if len(s) > 0 && strings.ContainsRune("=+-@\t\r", rune(s[0])) {
+		return "'" + s
+	}
+	return s
+}
@@ -2,25 +2,46 @@ package telegram
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"log/slog"
 	"net/http"
+
+	"github.com/ailinykh/waitlist/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
-func NewBot(token, endpoint string, logger *slog.Logger) (*Bot, error) {
-	me, err := getMe(endpoint, token)
-	if err != nil {
-		return nil, err
-	}
-	return &Bot{
-		User:     me,
+// NewBot asks Telegram about the bot, `ctx` bounds the call
+func NewBot(ctx context.Context, token, endpoint string, logger *slog.Logger, opts ...func(*Bot)) (*Bot, error) {
+	b := &Bot{
 		client:   http.DefaultClient,
 		endpoint: endpoint,
 		token:    token,
-		l:        logger.With("username", me.Username),
-	}, nil
+		tracer:   noop.NewTracerProvider().Tracer(tracing.Name),
+	}
+
+	for _, opt := range opts {
+		opt(b)
+	}
+
+	me, err := b.getMe(ctx)
+	if err != nil {
+		return nil, err
+	}
+	b.User = me
+	b.l = logger.With("username", me.Username)
+	return b, nil
+}
+
+// WithTracerProvider starts a span for every Bot API call
+func WithTracerProvider(tp trace.TracerProvider) func(*Bot) {
+	return func(b *Bot) {
+		b.tracer = tp.Tracer(tracing.Name)
+	}
 }
 
 type Bot struct {
@@ -29,10 +50,31 @@ type Bot struct {
 	endpoint string
 	token    string
 	l        *slog.Logger
+	tracer   trace.Tracer
 }
 
-func getMe(endpoint, token string) (*User, error) {
-	resp, err := http.DefaultClient.Get(endpoint + "/bot" + token + "/getMe")
+// startSpan names spans after the Bot API method, the url is never recorded since it contains the token
+func (b *Bot) startSpan(ctx context.Context, method string) (context.Context, trace.Span) {
+	attrs := []attribute.KeyValue{attribute.String("telegram.method", method)}
+	if b.User != nil {
+		attrs = append(attrs, attribute.String("telegram.bot", b.Username))
+	}
+	return b.tracer.Start(ctx, "telegram."+method, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attrs...))
+}
+
+func (b *Bot) getMe(ctx context.Context) (_ *User, err error) {
+	ctx, span := b.startSpan(ctx, "getMe")
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, b.endpoint+"/bot"+b.token+"/getMe", nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request %w", err)
+	}
+
+	resp, err := b.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect Telegram API %w", err)
 	}
@@ -60,7 +102,13 @@ func getMe(endpoint, token string) (*User, error) {
 	return &r.Result, nil
 }
 
-func (b *Bot) SendMessage(chatID int64, text string) (*Message, error) {
+func (b *Bot) SendMessage(ctx context.Context, chatID int64, text string) (_ *Message, err error) {
+	ctx, span := b.startSpan(ctx, "sendMessage")
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
 	o := struct {
 		ChatID int64  `json:"chat_id"`
 		Text   string `json:"text"`
@@ -74,7 +122,13 @@ func (b *Bot) SendMessage(chatID int64, text string) (*Message, error) {
 		return nil, fmt.Errorf("failed to pack message data %w", err)
 	}
 
-	resp, err := b.client.Post(b.endpoint+"/bot"+b.token+"/sendMessage", "application/json", bytes.NewBuffer(req))
+	httpReq, err := http.NewRequestWithContext(ctx, http.MethodPost, b.endpoint+"/bot"+b.token+"/sendMessage", bytes.NewBuffer(req))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request %w", err)
+	}
+	httpReq.Header.Set("Content-Type", "application/json")
+
+	resp, err := b.client.Do(httpReq)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect Telegram API %w", err)
 	}
@@ -96,10 +150,21 @@ func (b *Bot) SendMessage(chatID int64, text string) (*Message, error) {
 	return &r.Result, nil
 }
 
-func (b *Bot) GetUpdates(offset, timeout int64) ([]*Update, error) {
+func (b *Bot) GetUpdates(ctx context.Context, offset, timeout int64) (_ []*Update, err error) {
+	ctx, span := b.startSpan(ctx, "getUpdates")
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
 	urlString := fmt.Sprintf("%s/bot%s/getUpdates?offset=%d&timeout=%d", b.endpoint, b.token, offset, timeout)
-	b.l.Debug("start polling...", "offset", offset, "timeout", timeout)
-	resp, err := b.client.Get(urlString)
+	b.l.DebugContext(ctx, "start polling...", "offset", offset, "timeout", timeout)
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, urlString, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request %w", err)
+	}
+
+	resp, err := b.client.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect Telegram API %w", err)
 	}
@@ -110,7 +175,7 @@ func (b *Bot) GetUpdates(offset, timeout int64) ([]*Update, error) {
 		return nil, fmt.Errorf("failed to read `GetMe` body %w", err)
 	}
 
-	b.l.Debug("received response", "data", data)
+	b.l.DebugContext(ctx, "received response", "data", data)
 
 	var r struct {
 		Ok          bool      `json:"ok"`
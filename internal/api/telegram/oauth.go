@@ -4,6 +4,7 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"net/url"
 	"slices"
@@ -27,10 +28,13 @@ func ParseDataCheckString(values url.Values) string {
 	return strings.Join(pairs, "\n")
 }
 
-func CalculateHash(values url.Values, token string) string {
+var ErrHashMissing = errors.New("expected `hash` to be passed in url query")
+var ErrHashMismatch = errors.New("hash mismatch")
+
+func CalculateHash(values url.Values, token string) (string, error) {
 	hash := values.Get("hash")
 	if len(hash) == 0 {
-		return "expected `hash` to be passed in url query"
+		return "", ErrHashMissing
 	}
 
 	h := sha256.New()
@@ -40,5 +44,18 @@ func CalculateHash(values url.Values, token string) string {
 	sig := hmac.New(sha256.New, secret)
 	sig.Write([]byte(ParseDataCheckString(values)))
 
-	return hex.EncodeToString(sig.Sum(nil))
+	return hex.EncodeToString(sig.Sum(nil)), nil
+}
+
+// VerifyHash compares the `hash` passed in url query with the calculated one in constant time
+func VerifyHash(values url.Values, token string) error {
+	hash, err := CalculateHash(values, token)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(hash), []byte(values.Get("hash"))) {
+		return ErrHashMismatch
+	}
+	return nil
 }
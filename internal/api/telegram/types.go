@@ -33,6 +33,6 @@ type Message struct {
 	Entities []struct {
 		Offset int    `json:"offset"`
 		Length int    `json:"length"`
-		Type   string `json:"chat"`
+		Type   string `json:"type"`
 	}
 }
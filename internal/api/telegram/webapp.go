@@ -0,0 +1,64 @@
+package telegram
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/url"
+)
+
+// WebAppUser is the `user` field of Mini App init data
+type WebAppUser struct {
+	ID        int64  `json:"id"`
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name,omitempty"`
+	Username  string `json:"username,omitempty"`
+	PhotoUrl  string `json:"photo_url,omitempty"`
+}
+
+// CalculateWebAppHash calculates Mini App init data hash. Unlike Login Widget the secret key
+// is HMAC-SHA256 of the bot token with "WebAppData" key.
+// See https://core.telegram.org/bots/webapps#validating-data-received-via-the-mini-app
+func CalculateWebAppHash(values url.Values, token string) (string, error) {
+	hash := values.Get("hash")
+	if len(hash) == 0 {
+		return "", ErrHashMissing
+	}
+
+	h := hmac.New(sha256.New, []byte("WebAppData"))
+	h.Write([]byte(token))
+	secret := h.Sum(nil)
+
+	sig := hmac.New(sha256.New, secret)
+	sig.Write([]byte(ParseDataCheckString(values)))
+
+	return hex.EncodeToString(sig.Sum(nil)), nil
+}
+
+// VerifyWebAppHash compares the `hash` of init data with the calculated one in constant time
+func VerifyWebAppHash(values url.Values, token string) error {
+	hash, err := CalculateWebAppHash(values, token)
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(hash), []byte(values.Get("hash"))) {
+		return ErrHashMismatch
+	}
+	return nil
+}
+
+// ParseWebAppUser decodes JSON encoded `user` field of init data
+func ParseWebAppUser(values url.Values) (*WebAppUser, error) {
+	var user WebAppUser
+	if err := json.Unmarshal([]byte(values.Get("user")), &user); err != nil {
+		return nil, fmt.Errorf("failed to parse user: %w", err)
+	}
+
+	if user.ID == 0 {
+		return nil, fmt.Errorf("expected user id to be passed")
+	}
+	return &user, nil
+}
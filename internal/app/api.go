@@ -1,28 +1,79 @@
 package app
 
 import (
+	"context"
 	"encoding/json"
 	"log/slog"
 	"net/http"
+
+	"github.com/ailinykh/waitlist/internal/middleware"
+	"github.com/ailinykh/waitlist/internal/permission"
+	"github.com/ailinykh/waitlist/internal/repository"
 )
 
 func NewAPIHandlerFunc(logger *slog.Logger, repo Repo) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		waitlist, err := repo.GetAllEntries(r.Context())
+		user, err := middleware.UserFromContext(r.Context())
 		if err != nil {
-			logger.Error("failed to get waitlist", slog.Any("error", err))
+			logger.ErrorContext(r.Context(), "failed to read user from context", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		waitlist, err := getEntries(r.Context(), repo, user)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get waitlist", slog.Any("error", err))
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 			return
 		}
 
-		logger.Info("get all", slog.Int("count", len(waitlist)))
+		logger.InfoContext(r.Context(), "get all", slog.Int("count", len(waitlist)))
 
 		w.Header().Set("Content-Type", "application/json")
 
 		err = json.NewEncoder(w).Encode(waitlist)
 
 		if err != nil {
-			logger.Error("failed to encode waitlist", slog.Any("error", err))
+			logger.ErrorContext(r.Context(), "failed to encode waitlist", slog.Any("error", err))
+		}
+	}
+}
+
+// NewMyEntriesHandlerFunc lets any signed in user, e.g. from a Mini App, see their own waitlist status
+func NewMyEntriesHandlerFunc(logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		user, err := middleware.UserFromContext(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to read user from context", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		entries, err := repo.GetEntriesByUserID(r.Context(), user.UserID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get user entries", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
 		}
+
+		if entries == nil {
+			entries = []repository.WaitlistEntry{}
+		}
+
+		writeJSON(w, entries, logger)
 	}
 }
+
+// getEntries returns entries of the bots the user is allowed to see
+func getEntries(ctx context.Context, repo Repo, user *middleware.User) ([]repository.WaitlistEntry, error) {
+	if permission.Has(user.Role, permission.AllBots) {
+		return repo.GetAllEntries(ctx)
+	}
+
+	bots, err := repo.GetUserBots(ctx, user.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	return repo.GetEntriesByBotUsernames(ctx, bots)
+}
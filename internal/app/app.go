@@ -3,52 +3,113 @@ package app
 import (
 	"context"
 	"database/sql"
-	"errors"
-	"fmt"
 	"log/slog"
 	"net/http"
 	"time"
 
-	"github.com/ailinykh/waitlist/internal/api/telegram"
 	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/health"
+	"github.com/ailinykh/waitlist/internal/metrics"
 	"github.com/ailinykh/waitlist/internal/middleware"
+	"github.com/ailinykh/waitlist/internal/permission"
+	"github.com/ailinykh/waitlist/internal/ratelimit"
 
 	"github.com/ailinykh/waitlist/internal/repository"
+	"github.com/ailinykh/waitlist/pkg/jwt"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
 type Repo interface {
-	GetAllEntries(ctx context.Context) ([]repository.Waitlist, error)
+	GetAllEntries(ctx context.Context) ([]repository.WaitlistEntry, error)
+	GetEntriesByBotUsernames(ctx context.Context, botUsernames []string) ([]repository.WaitlistEntry, error)
+	GetEntriesByUserID(ctx context.Context, userID int64) ([]repository.WaitlistEntry, error)
 	CreateEntry(ctx context.Context, arg repository.CreateEntryParams) (sql.Result, error)
+	GetAllUsers(ctx context.Context) ([]repository.User, error)
 	GetUserByUserID(ctx context.Context, userID int64) (repository.User, error)
-	CreateUser(ctx context.Context, arg repository.CreateUserParams) (sql.Result, error)
+	UpsertUser(ctx context.Context, arg repository.UpsertUserParams) (repository.User, error)
+	UpdateUserRole(ctx context.Context, arg repository.UpdateUserRoleParams) (sql.Result, error)
+	UpdateUserActive(ctx context.Context, arg repository.UpdateUserActiveParams) (sql.Result, error)
+	CreateRoleChange(ctx context.Context, arg repository.CreateRoleChangeParams) (sql.Result, error)
+	GetRoleChangesByUserID(ctx context.Context, userID int64) ([]repository.RoleChange, error)
+	GetUserBots(ctx context.Context, userID int64) ([]string, error)
+	CreateUserBot(ctx context.Context, arg repository.CreateUserBotParams) (sql.Result, error)
+	DeleteUserBot(ctx context.Context, arg repository.DeleteUserBotParams) (sql.Result, error)
+	CreateRefreshToken(ctx context.Context, arg repository.CreateRefreshTokenParams) (sql.Result, error)
+	GetRefreshTokenByHash(ctx context.Context, tokenHash string) (repository.RefreshToken, error)
+	RevokeRefreshToken(ctx context.Context, arg repository.RevokeRefreshTokenParams) (sql.Result, error)
+	RevokeUserRefreshTokens(ctx context.Context, arg repository.RevokeUserRefreshTokensParams) (sql.Result, error)
+	CreateTokenRevocation(ctx context.Context, arg repository.CreateTokenRevocationParams) (sql.Result, error)
+	IsTokenRevoked(ctx context.Context, arg repository.IsTokenRevokedParams) (bool, error)
+	ClaimLoginPayload(ctx context.Context, arg repository.ClaimLoginPayloadParams) (sql.Result, error)
+	ReleaseLoginPayload(ctx context.Context, hash string) (sql.Result, error)
+	DeleteExpiredLoginPayloads(ctx context.Context, expiresAt time.Time) (sql.Result, error)
+	CountRepeatedEntries(ctx context.Context, arg repository.CountRepeatedEntriesParams) (int64, error)
+	GetBannedWords(ctx context.Context, botUsername string) ([]string, error)
+	CreateBannedWord(ctx context.Context, arg repository.CreateBannedWordParams) (sql.Result, error)
+	DeleteBannedWord(ctx context.Context, arg repository.DeleteBannedWordParams) (sql.Result, error)
+	GetBlockedUsers(ctx context.Context) ([]repository.BlockedUser, error)
+	IsUserBlocked(ctx context.Context, userID int64) (bool, error)
+	CreateBlockedUser(ctx context.Context, arg repository.CreateBlockedUserParams) (sql.Result, error)
+	DeleteBlockedUser(ctx context.Context, userID int64) (sql.Result, error)
+	InTx(ctx context.Context, fn func(*repository.Queries) error) error
 }
 
 func New(logger *slog.Logger, repo Repo, opts ...func(*Config)) (App, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("creating app", slog.Any("config", config))
+
+	return &appImpl{
+		config: config,
+		logger: logger,
+		repo:   repo,
+		stack:  newStack(logger, config, repo),
+	}, nil
+}
+
+func newConfig(opts ...func(*Config)) (*Config, error) {
 	config := &Config{
 		clock:               clock.New(),
 		port:                8080,
 		telegramBotEndpoint: "https://api.telegram.org",
+		telegramAuthMaxAge:  time.Minute * 10,
 		staticFilesDir:      "web/build",
+		jwtIssuer:           "waitlist",
+		jwtAudience:         "waitlist",
+		accessTokenTTL:      time.Minute * 15,
+		refreshTokenTTL:     time.Hour * 24 * 30,
+		secureCookies:       true,
+		rateLimit:           10,
+		rateLimitBurst:      30,
+		tracerProvider:      noop.NewTracerProvider(),
+		readinessChecks:     health.Checks{},
+		loginBotDomains:     map[string]string{},
+		securityPolicy:      middleware.DefaultSecurityPolicy(),
+		autocertCacheDir:    "certs",
+		readTimeout:         time.Second * 15,
+		writeTimeout:        time.Second * 30,
+		idleTimeout:         time.Minute * 2,
 	}
 
 	for _, opt := range opts {
 		opt(config)
 	}
 
-	logger.Info("creating app", slog.Any("config", config))
-
-	bot, err := telegram.NewBot(config.telegramBotToken, config.telegramBotEndpoint, logger)
-	if err != nil {
-		logger.Error("failed to create bot", "error", err)
-		return nil, err
+	if config.metrics == nil {
+		config.metrics = metrics.New()
 	}
 
-	return &appImpl{
-		config: config,
-		logger: logger,
-		repo:   repo,
-		stack:  newStack(logger, config, repo, bot.Username),
-	}, nil
+	if config.jwtKeys == nil {
+		keys, err := jwt.NewKeySet(jwt.NewHMACKey(config.jwtSecret))
+		if err != nil {
+			return nil, err
+		}
+		config.jwtKeys = keys
+	}
+	return config, nil
 }
 
 type App interface {
@@ -67,56 +128,70 @@ func (app *appImpl) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	app.stack.ServeHTTP(w, r)
 }
 
-func (app *appImpl) Run(ctx context.Context) error {
-	addr := fmt.Sprintf(":%d", app.config.port)
-	server := http.Server{
-		Addr:    addr,
-		Handler: app,
-	}
-
-	done := make(chan struct{})
-	go func() {
-		err := server.ListenAndServe()
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			app.logger.Error("failed to listen and serve", slog.Any("error", err))
-		}
-		close(done)
-	}()
-
-	app.logger.Info("server listening", slog.String("addr", addr))
-	select {
-	case <-done:
-		break
-	case <-ctx.Done():
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second*30)
-		server.Shutdown(ctx)
-		cancel()
-	}
-	return nil
-}
-
-func newStack(logger *slog.Logger, config *Config, repo Repo, username string) http.Handler {
+func newStack(logger *slog.Logger, config *Config, repo Repo) http.Handler {
 	router := http.NewServeMux()
 
-	fs := http.Dir(config.staticFilesDir)
+	var files http.FileSystem = http.Dir(config.staticFilesDir)
+	if config.staticFiles != nil {
+		files = http.FS(config.staticFiles)
+	}
 	router.Handle("/",
-		middleware.NewSPA(middleware.ServeFileContents("index.html", fs))(
-			http.FileServer(fs),
-		),
+		middleware.CreateStack(
+			middleware.NewSPA(middleware.ServeFileContents("index.html", files)),
+			middleware.Precompressed(files),
+		)(http.FileServer(files)),
 	)
 
-	router.HandleFunc("GET /api/telegram/oauth", NewOAuthHandlerFunc(logger, username))
-	router.HandleFunc("GET /api/telegram/oauth/token", NewCallbackHandlerFunc(config, repo, config.clock, logger))
+	rateLimit := middleware.RateLimit(ratelimit.New(config.rateLimit, config.rateLimitBurst, config.clock), config.trustedProxies, logger)
+
+	handleMonitoring(router, config, logger)
 
-	authStack := middleware.CreateStack(
-		middleware.JwtAuth(config.jwtSecret, middleware.User{}, config.clock, logger),
-		middleware.RoleAuth("admin", logger),
+	router.HandleFunc("GET /.well-known/jwks.json", NewJWKSHandlerFunc(config.jwtKeys, logger))
+	loginBots := newLoginBots(config, logger)
+	router.Handle("GET /api/telegram/oauth", rateLimit(NewOAuthHandlerFunc(loginBots, logger)))
+	router.Handle("GET /api/telegram/oauth/token", rateLimit(NewCallbackHandlerFunc(config, repo, loginBots, config.clock, logger)))
+	router.Handle("POST /api/telegram/webapp/auth", rateLimit(NewWebAppAuthHandlerFunc(config, repo, loginBots, config.clock, logger)))
+	router.Handle("POST /api/auth/refresh", rateLimit(NewRefreshHandlerFunc(config, repo, logger)))
+	router.Handle("POST /api/auth/logout", rateLimit(NewLogoutHandlerFunc(config, repo, logger)))
+
+	jwtAuth := middleware.JwtAuth(config.jwtKeys, middleware.User{}, revocationList{repo}, config.clock, logger,
+		jwt.WithIssuer(config.jwtIssuer),
+		jwt.WithAudience(config.jwtAudience),
 	)
+	authStack := func(p permission.Permission) middleware.Middleware {
+		return middleware.CreateStack(
+			jwtAuth,
+			rateLimit,
+			middleware.RequirePermission(p, logger),
+		)
+	}
 
-	router.Handle("GET /api/entries", authStack(NewAPIHandlerFunc(logger, repo)))
+	router.Handle("GET /api/entries", authStack(permission.ReadEntries)(NewAPIHandlerFunc(logger, repo)))
+	router.Handle("GET /api/me/entries", middleware.CreateStack(jwtAuth, rateLimit)(NewMyEntriesHandlerFunc(logger, repo)))
+	router.Handle("GET /api/users", authStack(permission.ManageUsers)(NewUsersHandlerFunc(logger, repo)))
+	router.Handle("PUT /api/users/{user_id}/role", authStack(permission.ManageUsers)(NewUserRoleHandlerFunc(config.clock, logger, repo)))
+	router.Handle("POST /api/users/{user_id}/activate", authStack(permission.ManageUsers)(NewUserActiveHandlerFunc(true, config.clock, logger, repo)))
+	router.Handle("POST /api/users/{user_id}/deactivate", authStack(permission.ManageUsers)(NewUserActiveHandlerFunc(false, config.clock, logger, repo)))
+	router.Handle("POST /api/users/{user_id}/revoke", authStack(permission.ManageUsers)(NewRevokeHandlerFunc(config, repo, logger)))
+	router.Handle("GET /api/users/{user_id}/audit", authStack(permission.ManageUsers)(NewUserAuditHandlerFunc(logger, repo)))
+	router.Handle("GET /api/users/{user_id}/bots", authStack(permission.ManageBots)(NewUserBotsHandlerFunc(logger, repo)))
+	router.Handle("PUT /api/users/{user_id}/bots/{bot_username}", authStack(permission.ManageBots)(NewUserBotHandlerFunc(true, logger, repo)))
+	router.Handle("DELETE /api/users/{user_id}/bots/{bot_username}", authStack(permission.ManageBots)(NewUserBotHandlerFunc(false, logger, repo)))
+	router.Handle("GET /api/blocklist", authStack(permission.ManageUsers)(NewBlocklistHandlerFunc(logger, repo)))
+	router.Handle("PUT /api/blocklist/{user_id}", authStack(permission.ManageUsers)(NewBlockUserHandlerFunc(true, logger, repo)))
+	router.Handle("DELETE /api/blocklist/{user_id}", authStack(permission.ManageUsers)(NewBlockUserHandlerFunc(false, logger, repo)))
+	router.Handle("GET /api/bots/{bot_username}/banned-words", authStack(permission.ManageBots)(NewBannedWordsHandlerFunc(logger, repo)))
+	router.Handle("PUT /api/bots/{bot_username}/banned-words/{word}", authStack(permission.ManageBots)(NewBannedWordHandlerFunc(true, logger, repo)))
+	router.Handle("DELETE /api/bots/{bot_username}/banned-words/{word}", authStack(permission.ManageBots)(NewBannedWordHandlerFunc(false, logger, repo)))
 
 	stack := middleware.CreateStack(
+		middleware.RequestID(),
+		middleware.Tracing(config.tracerProvider),
 		middleware.Logging(logger),
+		middleware.Metrics(config.metrics),
+		middleware.SecurityHeaders(config.securityPolicy),
+		middleware.CORS(config.corsPolicy, logger),
+		middleware.CSRF([]string{middleware.AuthCookie, refreshCookie}, logger),
 	)
 
 	return stack(router)
@@ -1,129 +1,419 @@
 package app
 
 import (
-	"database/sql"
+	"context"
 	"encoding/json"
 	"errors"
+	"fmt"
 	"log/slog"
+	"net"
 	"net/http"
+	"net/url"
+	"slices"
 	"strconv"
+	"strings"
+	"sync"
 	"time"
 
 	"github.com/ailinykh/waitlist/internal/api/telegram"
 	"github.com/ailinykh/waitlist/internal/clock"
-	"github.com/ailinykh/waitlist/internal/middleware"
+	"github.com/ailinykh/waitlist/internal/permission"
 	"github.com/ailinykh/waitlist/internal/repository"
-	"github.com/ailinykh/waitlist/pkg/jwt"
 )
 
-func NewOAuthHandlerFunc(logger *slog.Logger, username string) http.HandlerFunc {
+// telegramAuthClockSkew tolerates `auth_date` slightly ahead of the server clock
+const telegramAuthClockSkew = time.Minute
+
+// NewOAuthHandlerFunc tells the SPA which bot Login Widget to show, see `loginBots`
+func NewOAuthHandlerFunc(bots *loginBots, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := selectLoginBot(w, r, bots, logger)
+		if !ok {
+			return
+		}
+
+		username, err := bots.Username(r.Context(), token)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get login bot", slog.Any("error", err))
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+			return
+		}
+
 		w.Header().Add("Content-Type", "application/json")
 
-		err := json.NewEncoder(w).Encode(struct {
+		err = json.NewEncoder(w).Encode(struct {
 			Username string `json:"username"`
 		}{
 			Username: username,
 		})
 
 		if err != nil {
-			logger.Error("failed to marshal response", slog.Any("error", err))
+			logger.ErrorContext(r.Context(), "failed to marshal response", slog.Any("error", err))
 		}
 	}
 }
 
-func NewLogutHandlerFunc() http.HandlerFunc {
-	return func(w http.ResponseWriter, r *http.Request) {
-		http.SetCookie(w, &http.Cookie{
-			Name:     "auth",
-			Value:    "",
-			MaxAge:   -1,
-			Path:     "/",
-			HttpOnly: true, // can't be accessed by JavaScript
-		})
-		http.Redirect(w, r, "/", http.StatusFound)
+var errUnknownLoginBot = errors.New("unknown login bot")
+
+const (
+	// loginBotRetryInterval keeps a bot Telegram failed to tell about from being asked on every request
+	loginBotRetryInterval = time.Second * 30
+	// loginBotLookupTimeout bounds `getMe`, the requests waiting for it give up along with their own context
+	loginBotLookupTimeout = time.Second * 10
+)
+
+// loginBots are the bots users log in through. The bot is picked by `bot` query parameter,
+// then by the request host, see `WithLoginBotDomain`, the `WithTelegramBotToken` one is the default.
+// Usernames are only asked from Telegram when needed and remembered, so the API starts without calling Telegram.
+type loginBots struct {
+	config  *Config
+	logger  *slog.Logger
+	mu      sync.Mutex
+	lookups map[string]*botLookup
+}
+
+// botLookup is a `getMe` call shared by the requests waiting for it, the results are set once `done` is closed
+type botLookup struct {
+	started  time.Time
+	done     chan struct{}
+	username string
+	err      error
+	at       time.Time
+}
+
+func newLoginBots(config *Config, logger *slog.Logger) *loginBots {
+	return &loginBots{
+		config:  config,
+		logger:  logger,
+		lookups: map[string]*botLookup{},
+	}
+}
+
+// Select returns the token of the bot the request is meant for
+func (b *loginBots) Select(r *http.Request) (string, error) {
+	username := r.URL.Query().Get("bot")
+	if len(username) == 0 {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		username = b.config.loginBotDomains[strings.ToLower(host)]
+	}
+
+	if len(username) == 0 {
+		return b.config.telegramBotToken, nil
+	}
+
+	// a bot Telegram fails to tell about should not break login through the other ones
+	for _, token := range append([]string{b.config.telegramBotToken}, b.config.loginBotTokens...) {
+		name, err := b.Username(r.Context(), token)
+		if err != nil {
+			if ctxErr := r.Context().Err(); ctxErr != nil {
+				return "", ctxErr
+			}
+			b.logger.WarnContext(r.Context(), "failed to get login bot", slog.Any("error", err))
+			continue
+		}
+		if strings.EqualFold(name, strings.TrimPrefix(username, "@")) {
+			return token, nil
+		}
 	}
+	return "", fmt.Errorf("%w %s", errUnknownLoginBot, username)
 }
 
-func NewCallbackHandlerFunc(config *Config, repo Repo, clock clock.Clock, logger *slog.Logger) http.HandlerFunc {
+// Username asks Telegram once per token, concurrent requests wait for the same call without holding the lock.
+// Failures are remembered for `loginBotRetryInterval`, a lookup pending that long is started over.
+func (b *loginBots) Username(ctx context.Context, token string) (string, error) {
+	b.mu.Lock()
+	now := b.config.clock.Now()
+	lookup, ok := b.lookups[token]
+	if !ok || lookup.stale(now) {
+		lookup = &botLookup{started: now, done: make(chan struct{})}
+		b.lookups[token] = lookup
+		go b.lookup(token, lookup)
+	}
+	b.mu.Unlock()
+
+	select {
+	case <-lookup.done:
+		return lookup.username, lookup.err
+	case <-ctx.Done():
+		return "", ctx.Err()
+	}
+}
+
+func (b *loginBots) lookup(token string, lookup *botLookup) {
+	defer close(lookup.done)
+
+	// the lookup is shared, so it is not canceled along with the request that started it
+	ctx, cancel := context.WithTimeout(context.Background(), loginBotLookupTimeout)
+	defer cancel()
+
+	bot, err := telegram.NewBot(ctx, token, b.config.telegramBotEndpoint, b.logger, telegram.WithTracerProvider(b.config.tracerProvider))
+	lookup.at = b.config.clock.Now()
+	if err != nil {
+		lookup.err = err
+		return
+	}
+	lookup.username = bot.Username
+}
+
+// stale reports whether the lookup failed or is pending for longer than `loginBotRetryInterval`
+func (l *botLookup) stale(now time.Time) bool {
+	select {
+	case <-l.done:
+		return l.err != nil && now.Sub(l.at) > loginBotRetryInterval
+	default:
+		return now.Sub(l.started) > loginBotRetryInterval
+	}
+}
+
+// selectLoginBot writes the error response when no bot fits the request
+func selectLoginBot(w http.ResponseWriter, r *http.Request, bots *loginBots, logger *slog.Logger) (string, bool) {
+	token, err := bots.Select(r)
+	if err != nil {
+		if errors.Is(err, errUnknownLoginBot) {
+			logger.ErrorContext(r.Context(), "unknown login bot", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+		} else {
+			logger.ErrorContext(r.Context(), "failed to get login bot", slog.Any("error", err))
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		}
+		return "", false
+	}
+	return token, true
+}
+
+// NewCallbackHandlerFunc accepts Telegram Login Widget payload signed by the selected login bot. The payload
+// is only valid for `telegramAuthMaxAge` and can be used once, so a leaked login url is of no use.
+// Used payloads are kept in the database, so a payload used with one replica is rejected by the others.
+func NewCallbackHandlerFunc(config *Config, repo Repo, bots *loginBots, clock clock.Clock, logger *slog.Logger) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		logger.Info("callback",
+		logger.DebugContext(r.Context(), "callback",
 			slog.String("path", r.URL.Path),
-			slog.String("raw", r.URL.RawQuery),
-			slog.Any("query", r.URL.Query()),
+			slog.String("query", r.URL.RawQuery),
 		)
 
+		token, ok := selectLoginBot(w, r, bots, logger)
+		if !ok {
+			return
+		}
+
+		// the bot is chosen by the SPA, it is not a part of the signed payload
 		values := r.URL.Query()
+		values.Del("bot")
 
-		if telegram.CalculateHash(values, config.telegramBotToken) != values.Get("hash") {
-			logger.Error("❌ checksum mismatch", slog.String("query", r.URL.RawQuery))
+		if err := telegram.VerifyHash(values, token); err != nil {
+			logger.ErrorContext(r.Context(), "❌ checksum mismatch", slog.Any("error", err), slog.String("query", r.URL.RawQuery))
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		logger.Info("got new callback", slog.String("auth_date", values.Get("auth_date")))
+		logger.InfoContext(r.Context(), "got new callback", slog.String("auth_date", values.Get("auth_date")))
+
+		issuedAt, err := checkAuthDate(values, config, clock)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "invalid auth_date", slog.Any("error", err))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 
 		userID, err := strconv.ParseInt(values.Get("id"), 10, 64)
 		if err != nil {
-			logger.Error("failed to parse user_id", slog.Any("error", err))
+			logger.ErrorContext(r.Context(), "failed to parse user_id", slog.Any("error", err))
 			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		var user repository.User
-		user, err = repo.GetUserByUserID(r.Context(), userID)
+		hash := values.Get("hash")
+		claimed, err := claimLoginPayload(r.Context(), repo, hash, issuedAt.Add(config.telegramAuthMaxAge), clock.Now(), logger)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				_, err := repo.CreateUser(r.Context(), repository.CreateUserParams{
-					UserID:    userID,
-					FirstName: values.Get("first_name"),
-					LastName:  values.Get("last_name"),
-					Username:  values.Get("username"),
-					PhotoUrl:  values.Get("photo_url"),
-				})
-				if err != nil {
-					logger.Error("failed to create user", slog.Any("error", err), slog.String("query", r.URL.RawQuery))
-					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
-					return
-				} else {
-					user, _ = repo.GetUserByUserID(r.Context(), userID)
-				}
-			} else {
-				logger.Error("failed to find user by id", slog.Any("error", err), slog.Int64("user_id", userID))
+			logger.ErrorContext(r.Context(), "failed to claim login payload", slog.Any("error", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if !claimed {
+			logger.ErrorContext(r.Context(), "replayed login payload", slog.String("auth_date", values.Get("auth_date")))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		ok = login(w, r, config, repo, repository.UpsertUserParams{
+			UserID:    userID,
+			FirstName: values.Get("first_name"),
+			LastName:  values.Get("last_name"),
+			Username:  values.Get("username"),
+			PhotoUrl:  values.Get("photo_url"),
+		}, logger)
+
+		// the payload is only used up by a session issued, e.g. the user retries after the database recovers
+		if !ok {
+			if _, err := repo.ReleaseLoginPayload(r.Context(), hash); err != nil {
+				logger.ErrorContext(r.Context(), "failed to release login payload", slog.Any("error", err))
 			}
 		}
+	}
+}
 
-		ttl := clock.Now().Add(time.Hour * 24 * 100)
+// claimLoginPayload reports false when the payload was already used, the claim is kept until `expiresAt`
+func claimLoginPayload(ctx context.Context, repo Repo, hash string, expiresAt, now time.Time, logger *slog.Logger) (bool, error) {
+	res, err := repo.ClaimLoginPayload(ctx, repository.ClaimLoginPayloadParams{
+		Hash:      hash,
+		ExpiresAt: expiresAt,
+		Now:       now,
+	})
+	if err != nil {
+		return false, err
+	}
 
-		// logger.Info("ttl", "ttl", ttl.String())
-		// tokenString, err := token.SignedString([]byte(config.jwtSecret))
+	claimed, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
 
-		tokenString, err := jwt.Encode(config.jwtSecret, map[string]interface{}{
-			"payload": middleware.User{
-				UserID:    user.UserID,
-				FirstName: user.FirstName,
-				LastName:  user.LastName,
-				Username:  user.Username,
-				Role:      user.Role,
-			},
-			"ttl": ttl.Unix(),
-		})
+	if _, err := repo.DeleteExpiredLoginPayloads(ctx, now); err != nil {
+		logger.WarnContext(ctx, "failed to delete expired login payloads", slog.Any("error", err))
+	}
+	return claimed > 0, nil
+}
+
+// NewWebAppAuthHandlerFunc accepts Mini App `initData` signed by the selected login bot. Telegram passes the same
+// init data on every launch of the Mini App, so it is only checked against `telegramAuthMaxAge`.
+func NewWebAppAuthHandlerFunc(config *Config, repo Repo, bots *loginBots, clock clock.Clock, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			InitData string `json:"init_data"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode request body", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
 
+		values, err := url.ParseQuery(body.InitData)
 		if err != nil {
-			logger.Error("failed sign jwt token", slog.Any("error", err))
-			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			logger.ErrorContext(r.Context(), "failed to parse init data", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
 			return
 		}
 
-		w.Header().Add("Content-Type", "application/json")
-		err = json.NewEncoder(w).Encode(struct {
-			Token string `json:"token"`
-		}{
-			Token: tokenString,
-		})
+		token, ok := selectLoginBot(w, r, bots, logger)
+		if !ok {
+			return
+		}
+
+		if err := telegram.VerifyWebAppHash(values, token); err != nil {
+			logger.ErrorContext(r.Context(), "❌ checksum mismatch", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if _, err := checkAuthDate(values, config, clock); err != nil {
+			logger.ErrorContext(r.Context(), "invalid auth_date", slog.Any("error", err))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
 
+		user, err := telegram.ParseWebAppUser(values)
 		if err != nil {
-			logger.Error("failed to marshal response", slog.Any("error", err))
+			logger.ErrorContext(r.Context(), "failed to parse init data user", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
 		}
+
+		login(w, r, config, repo, repository.UpsertUserParams{
+			UserID:    user.ID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Username:  user.Username,
+			PhotoUrl:  user.PhotoUrl,
+		}, logger)
+	}
+}
+
+// checkAuthDate makes sure the signed payload is not older than `telegramAuthMaxAge`
+func checkAuthDate(values url.Values, config *Config, clock clock.Clock) (time.Time, error) {
+	authDate, err := strconv.ParseInt(values.Get("auth_date"), 10, 64)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("failed to parse auth_date: %w", err)
+	}
+
+	issuedAt := time.Unix(authDate, 0)
+	now := clock.Now()
+	if now.Sub(issuedAt) > config.telegramAuthMaxAge || issuedAt.Sub(now) > telegramAuthClockSkew {
+		return time.Time{}, fmt.Errorf("stale auth_date %s at %s", issuedAt, now)
+	}
+	return issuedAt, nil
+}
+
+// login refreshes the profile of the user verified by Telegram and issues the session tokens, it reports whether it did
+func login(w http.ResponseWriter, r *http.Request, config *Config, repo Repo, profile repository.UpsertUserParams, logger *slog.Logger) bool {
+	user, err := upsertUser(r.Context(), config, repo, profile, logger)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to upsert user", slog.Any("error", err), slog.Int64("user_id", profile.UserID))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
+	}
+
+	if !user.Active {
+		logger.ErrorContext(r.Context(), "inactive user attempt to login", slog.Int64("user_id", user.UserID))
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return false
+	}
+
+	tokens, err := issueTokens(r.Context(), config, repo, user)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to issue tokens", slog.Any("error", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return false
 	}
+
+	writeSession(w, r, config, tokens, r.Header.Get(SessionTypeHeader) == "bearer", logger)
+	return true
+}
+
+// upsertUser creates or refreshes the user profile. Configured admins get the admin role once,
+// so a later demotion by another admin is not overridden on the next login.
+func upsertUser(ctx context.Context, config *Config, repo Repo, profile repository.UpsertUserParams, logger *slog.Logger) (repository.User, error) {
+	profile.Role = permission.RoleUser
+	user, err := repo.UpsertUser(ctx, profile)
+	if err != nil {
+		return user, err
+	}
+
+	if user.Role != permission.RoleUser || !slices.Contains(config.adminTelegramIDs, user.UserID) {
+		return user, nil
+	}
+
+	changes, err := repo.GetRoleChangesByUserID(ctx, user.UserID)
+	if err != nil {
+		return user, fmt.Errorf("failed to get role changes: %w", err)
+	}
+
+	if len(changes) > 0 {
+		return user, nil
+	}
+
+	logger.InfoContext(ctx, "promoting user to admin", slog.Int64("user_id", user.UserID))
+	_, err = repo.UpdateUserRole(ctx, repository.UpdateUserRoleParams{
+		UserID: user.UserID,
+		Role:   permission.RoleAdmin,
+	})
+	if err != nil {
+		return user, fmt.Errorf("failed to promote user: %w", err)
+	}
+
+	_, err = repo.CreateRoleChange(ctx, repository.CreateRoleChangeParams{
+		UserID:    user.UserID,
+		OldRole:   permission.RoleUser,
+		NewRole:   permission.RoleAdmin,
+		ChangedBy: SystemUserID,
+	})
+	if err != nil {
+		logger.ErrorContext(ctx, "failed to record role change", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+	}
+
+	user.Role = permission.RoleAdmin
+	return user, nil
 }
@@ -1,8 +1,17 @@
 package app_test
 
 import (
+	"context"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
 	"testing"
+	"time"
 
+	"github.com/ailinykh/waitlist/internal/api/telegram"
 	"github.com/ailinykh/waitlist/internal/app"
 	"github.com/ailinykh/waitlist/internal/clock"
 	h "github.com/ailinykh/waitlist/pkg/http_test"
@@ -29,4 +38,256 @@ func TestLoginAPI(t *testing.T) {
 			h.WithBody([]byte(`{"username":"waitlist_bot"}`)),
 		)
 	})
+
+	t.Run("it does not publish symmetric keys", func(t *testing.T) {
+		h.Expect(t, app).Request(
+			h.WithUrl("/.well-known/jwks.json"),
+		).ToRespond(
+			h.WithCode(200),
+			h.WithContentType("application/json"),
+			h.WithBody([]byte(`{"keys":[]}`)),
+		)
+	})
+
+	t.Run("it authenticates mini app users", func(t *testing.T) {
+		initData := webAppInitData(t, "0123456789:TeLeGRAMm_bot-T0keN",
+			`query_id=AAHdF6IQAAAAAN0XohDhrOrc&user={"id":11,"first_name":"cat","last_name":"person","username":"ilovecats"}&auth_date=1376517600`,
+		)
+
+		var resp struct {
+			Token string `json:"token"`
+		}
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/telegram/webapp/auth"),
+			h.WithData(initData),
+			h.WithHeader("X-Session-Type", "bearer"),
+		).ToRespond(
+			h.WithCode(200),
+			h.DecodeJSON(&resp),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithUrl("/api/me/entries"),
+			h.WithHeader("Authorization", "Bearer "+resp.Token),
+		).ToRespond(
+			h.WithCode(200),
+			h.WithBody([]byte(`[]`)),
+		)
+	})
+
+	t.Run("it validates mini app init data hash", func(t *testing.T) {
+		initData := webAppInitData(t, "another-bot-token",
+			`user={"id":11,"first_name":"cat"}&auth_date=1376517600`,
+		)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/telegram/webapp/auth"),
+			h.WithData(initData),
+		).ToRespond(
+			h.WithCode(400),
+		)
+	})
+
+	t.Run("it rejects stale mini app init data", func(t *testing.T) {
+		initData := webAppInitData(t, "0123456789:TeLeGRAMm_bot-T0keN",
+			`user={"id":11,"first_name":"cat"}&auth_date=1376510400`,
+		)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/telegram/webapp/auth"),
+			h.WithData(initData),
+		).ToRespond(
+			h.WithCode(401),
+		)
+	})
+}
+
+func TestLoginBotUnavailable(t *testing.T) {
+	// the app starts without calling Telegram, the login bot is only looked up when needed
+	sut, err := app.New(slog.Default(), nil,
+		app.WithJwtSecret("jwt-secret"),
+		app.WithTelegramBotToken("telegram-secret"),
+		app.WithTelegramBotEndpoint("http://127.0.0.1:1"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	h.Expect(t, sut).Request(
+		h.WithUrl("/api/telegram/oauth"),
+	).ToRespond(
+		h.WithCode(502),
+	)
+
+	t.Run("it remembers failures and keeps other bots working", func(t *testing.T) {
+		var failures atomic.Int32
+		svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/botother-secret/getMe" {
+				w.Write([]byte(`{"ok":true,"result":{"id":2,"is_bot":true,"first_name":"other","username":"other_bot"}}`))
+				return
+			}
+			failures.Add(1)
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"ok":false,"description":"Internal Server Error"}`))
+		}))
+		t.Cleanup(svr.Close)
+
+		sut, err := app.New(slog.Default(), nil,
+			app.WithJwtSecret("jwt-secret"),
+			app.WithTelegramBotToken("telegram-secret"),
+			app.WithTelegramBotEndpoint(svr.URL),
+			app.WithLoginBots("other-secret"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		for range 2 {
+			h.Expect(t, sut).Request(
+				h.WithUrl("/api/telegram/oauth"),
+			).ToRespond(
+				h.WithCode(502),
+			)
+		}
+
+		h.Expect(t, sut).Request(
+			h.WithUrl("/api/telegram/oauth?bot=other_bot"),
+		).ToRespond(
+			h.WithCode(200),
+			h.WithBody([]byte(`{"username":"other_bot"}`)),
+		)
+
+		h.Expect(t, sut).Request(
+			h.WithUrl("/api/telegram/oauth?bot=unknown_bot"),
+		).ToRespond(
+			h.WithCode(400),
+		)
+
+		if n := failures.Load(); n != 1 {
+			t.Errorf("expected failed bot to be asked once, got %d", n)
+		}
+	})
+}
+
+func TestLoginBotHangs(t *testing.T) {
+	hang := make(chan struct{})
+	var calls atomic.Int32
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if calls.Add(1) == 1 {
+			<-hang
+		}
+		w.Write([]byte(`{"ok":true,"result":{"id":1,"is_bot":true,"first_name":"waitlist","username":"waitlist_bot"}}`))
+	}))
+	t.Cleanup(svr.Close)
+	t.Cleanup(func() { close(hang) })
+
+	clk := clock.NewFake(clock.MustParse("2013-08-14T22:00:00.123456789Z"))
+	sut, err := app.New(slog.Default(), nil,
+		app.WithJwtSecret("jwt-secret"),
+		app.WithTelegramBotToken("telegram-secret"),
+		app.WithTelegramBotEndpoint(svr.URL),
+		app.WithClock(clk),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	request := func() int {
+		ctx, cancel := context.WithTimeout(t.Context(), time.Millisecond*100)
+		defer cancel()
+
+		w := httptest.NewRecorder()
+		sut.ServeHTTP(w, httptest.NewRequestWithContext(ctx, http.MethodGet, "/api/telegram/oauth", nil))
+		return w.Code
+	}
+
+	if code := request(); code != 502 {
+		t.Errorf("expected 502 while Telegram hangs, got %d", code)
+	}
+
+	clk.Add(time.Minute)
+	if code := request(); code != 200 {
+		t.Errorf("expected the stale lookup to be started over, got %d", code)
+	}
+}
+
+func TestLoginBots(t *testing.T) {
+	svr := makeServerMock(t, "test_login_bots")
+	sut, _ := makeSUT(t,
+		app.WithJwtSecret("jwt-secret"),
+		app.WithTelegramBotToken("telegram-secret"),
+		app.WithTelegramBotEndpoint(svr.URL),
+		app.WithLoginBots("other-secret"),
+		app.WithLoginBotDomain("Other.Example.com", "other_bot"),
+		app.WithClock(
+			clock.New(clock.WithTime(clock.MustParse("2013-08-14T22:00:00.123456789Z"))),
+		),
+	)
+
+	t.Run("it selects login bot by domain", func(t *testing.T) {
+		h.Expect(t, sut).Request(
+			h.WithUrl("http://other.example.com:8080/api/telegram/oauth"),
+		).ToRespond(
+			h.WithCode(200),
+			h.WithBody([]byte(`{"username":"other_bot"}`)),
+		)
+	})
+
+	t.Run("it falls back to the default login bot", func(t *testing.T) {
+		h.Expect(t, sut).Request(
+			h.WithUrl("/api/telegram/oauth"),
+		).ToRespond(
+			h.WithCode(200),
+			h.WithBody([]byte(`{"username":"waitlist_bot"}`)),
+		)
+	})
+
+	t.Run("it rejects unknown login bot", func(t *testing.T) {
+		h.Expect(t, sut).Request(
+			h.WithUrl("/api/telegram/oauth?bot=unknown_bot"),
+		).ToRespond(
+			h.WithCode(400),
+		)
+	})
+
+	t.Run("it verifies payload with the selected bot", func(t *testing.T) {
+		h.Expect(t, sut).Request(
+			h.WithUrl(botLoginURL(t, "other-secret", "id=11&first_name=cat&auth_date=1376517600") + "&bot=other_bot"),
+		).ToRespond(
+			h.WithCode(200),
+		)
+	})
+
+	t.Run("it rejects payload of another bot", func(t *testing.T) {
+		h.Expect(t, sut).Request(
+			h.WithUrl(botLoginURL(t, "other-secret", "id=11&first_name=cat&auth_date=1376517599")),
+		).ToRespond(
+			h.WithCode(400),
+		)
+	})
+}
+
+// webAppInitData signs Mini App init data the way Telegram does and wraps it into request body
+func webAppInitData(t testing.TB, token, query string) []byte {
+	t.Helper()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	values.Set("hash", "-")
+	hash, err := telegram.CalculateWebAppHash(values, token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values.Set("hash", hash)
+
+	data, err := json.Marshal(map[string]string{"init_data": values.Encode()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
 }
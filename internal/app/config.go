@@ -1,19 +1,57 @@
 package app
 
 import (
+	"io/fs"
 	"log/slog"
+	"net/netip"
 	"strings"
+	"time"
 
 	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/health"
+	"github.com/ailinykh/waitlist/internal/logging"
+	"github.com/ailinykh/waitlist/internal/metrics"
+	"github.com/ailinykh/waitlist/internal/middleware"
+	"github.com/ailinykh/waitlist/pkg/jwt"
+	"go.opentelemetry.io/otel/trace"
 )
 
 type Config struct {
 	clock               clock.Clock
 	port                int
+	tlsCertFile         string
+	tlsKeyFile          string
+	autocertDomains     []string
+	autocertCacheDir    string
+	autocertEmail       string
+	redirectPort        int
+	readTimeout         time.Duration
+	writeTimeout        time.Duration
+	idleTimeout         time.Duration
 	telegramBotToken    string
+	loginBotTokens      []string
+	loginBotDomains     map[string]string
 	telegramBotEndpoint string
+	telegramAuthMaxAge  time.Duration
 	jwtSecret           string
+	jwtKeys             *jwt.KeySet
+	jwtIssuer           string
+	jwtAudience         string
 	staticFilesDir      string
+	staticFiles         fs.FS
+	adminTelegramIDs    []int64
+	accessTokenTTL      time.Duration
+	refreshTokenTTL     time.Duration
+	secureCookies       bool
+	rateLimit           float64
+	rateLimitBurst      int
+	trustedProxies      []netip.Prefix
+	metrics             *metrics.Metrics
+	metricsToken        string
+	tracerProvider      trace.TracerProvider
+	readinessChecks     health.Checks
+	securityPolicy      middleware.SecurityPolicy
+	corsPolicy          middleware.CORSPolicy
 }
 
 func WithClock(clock clock.Clock) func(*Config) {
@@ -28,41 +66,231 @@ func WithPort(port int) func(*Config) {
 	}
 }
 
+// WithTLSCertificate serves HTTPS with the certificate and key from PEM files
+func WithTLSCertificate(certFile, keyFile string) func(*Config) {
+	return func(c *Config) {
+		c.tlsCertFile = certFile
+		c.tlsKeyFile = keyFile
+	}
+}
+
+// WithAutocert serves HTTPS with Let's Encrypt certificates for the `domains`, certificates are kept in `cacheDir`
+// so restarts do not hit the rate limits. `email` is optional and receives expiry notices.
+func WithAutocert(cacheDir, email string, domains ...string) func(*Config) {
+	return func(c *Config) {
+		c.autocertCacheDir = cacheDir
+		c.autocertEmail = email
+		c.autocertDomains = domains
+	}
+}
+
+// WithHTTPRedirect listens for plain HTTP on the `port` and redirects to HTTPS,
+// the ACME HTTP-01 challenge is answered there too, so it is usually 80
+func WithHTTPRedirect(port int) func(*Config) {
+	return func(c *Config) {
+		c.redirectPort = port
+	}
+}
+
+// WithTimeouts limits reading a request, writing a response and keeping an idle connection, zero means no limit
+func WithTimeouts(read, write, idle time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.readTimeout = read
+		c.writeTimeout = write
+		c.idleTimeout = idle
+	}
+}
+
+// WithTelegramBotToken sets the default login bot, Telegram Login Widget and Mini App payloads are verified with its token
 func WithTelegramBotToken(token string) func(*Config) {
 	return func(c *Config) {
 		c.telegramBotToken = token
 	}
 }
 
+// WithLoginBots lets users log in through other bots too, the SPA picks one with `?bot=<username>`
+func WithLoginBots(tokens ...string) func(*Config) {
+	return func(c *Config) {
+		c.loginBotTokens = tokens
+	}
+}
+
+// WithLoginBotDomain makes requests to the `host` log in through the bot with the `username`,
+// it has to be the default login bot or one of `WithLoginBots`
+func WithLoginBotDomain(host, username string) func(*Config) {
+	return func(c *Config) {
+		c.loginBotDomains[strings.ToLower(host)] = username
+	}
+}
+
 func WithTelegramBotEndpoint(endpoint string) func(*Config) {
 	return func(c *Config) {
 		c.telegramBotEndpoint = endpoint
 	}
 }
 
+// WithTelegramAuthMaxAge limits how long Telegram login payload stays valid after `auth_date`
+func WithTelegramAuthMaxAge(maxAge time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.telegramAuthMaxAge = maxAge
+	}
+}
+
 func WithJwtSecret(token string) func(*Config) {
 	return func(c *Config) {
 		c.jwtSecret = token
 	}
 }
 
+// WithJwtKeys sets a keyset for signing and verifying tokens, it takes precedence over `WithJwtSecret`
+func WithJwtKeys(keys *jwt.KeySet) func(*Config) {
+	return func(c *Config) {
+		c.jwtKeys = keys
+	}
+}
+
+func WithJwtIssuer(issuer string) func(*Config) {
+	return func(c *Config) {
+		c.jwtIssuer = issuer
+	}
+}
+
+func WithJwtAudience(audience string) func(*Config) {
+	return func(c *Config) {
+		c.jwtAudience = audience
+	}
+}
+
 func WithStaticFilesDir(dir string) func(*Config) {
 	return func(c *Config) {
 		c.staticFilesDir = dir
+		c.staticFiles = nil
 	}
 }
 
-func (c Config) LogValue() slog.Value {
-	safe := func(text string) string {
-		if len(text) < 5 {
-			return strings.Repeat("*", len(text))
-		}
-		return text[:2] + strings.Repeat("*", len(text)-4) + text[len(text)-2:]
+// WithStaticFiles serves the SPA from `files`, e.g. the build embedded into the binary, instead of `WithStaticFilesDir`
+func WithStaticFiles(files fs.FS) func(*Config) {
+	return func(c *Config) {
+		c.staticFiles = files
 	}
+}
+
+// WithAdminTelegramIDs sets Telegram user IDs that get the admin role on their first login.
+func WithAdminTelegramIDs(ids ...int64) func(*Config) {
+	return func(c *Config) {
+		c.adminTelegramIDs = ids
+	}
+}
+
+func WithAccessTokenTTL(ttl time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.accessTokenTTL = ttl
+	}
+}
+
+func WithRefreshTokenTTL(ttl time.Duration) func(*Config) {
+	return func(c *Config) {
+		c.refreshTokenTTL = ttl
+	}
+}
+
+// WithSecureCookies marks session cookies `Secure`, it is only meant to be disabled for local development over plain HTTP
+func WithSecureCookies(secure bool) func(*Config) {
+	return func(c *Config) {
+		c.secureCookies = secure
+	}
+}
+
+// WithRateLimit allows `burst` API requests per user or client IP, refilled at `rate` requests per second
+func WithRateLimit(rate float64, burst int) func(*Config) {
+	return func(c *Config) {
+		c.rateLimit = rate
+		c.rateLimitBurst = burst
+	}
+}
+
+// WithTrustedProxies sets proxies allowed to pass client IP in `X-Forwarded-For` header
+func WithTrustedProxies(prefixes ...netip.Prefix) func(*Config) {
+	return func(c *Config) {
+		c.trustedProxies = prefixes
+	}
+}
+
+// WithMetrics collects HTTP metrics into `m`
+func WithMetrics(m *metrics.Metrics) func(*Config) {
+	return func(c *Config) {
+		c.metrics = m
+	}
+}
+
+// WithMetricsToken exposes `/metrics` to scrapers passing `Authorization: Bearer <token>`,
+// the endpoint is not served without a token
+func WithMetricsToken(token string) func(*Config) {
+	return func(c *Config) {
+		c.metricsToken = token
+	}
+}
+
+// WithTracerProvider traces inbound requests and Telegram calls of the login bot
+func WithTracerProvider(tp trace.TracerProvider) func(*Config) {
+	return func(c *Config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithReadinessCheck adds a component reported by `/readyz`
+func WithReadinessCheck(name string, check health.Check) func(*Config) {
+	return func(c *Config) {
+		c.readinessChecks[name] = check
+	}
+}
+
+// WithSecurityPolicy replaces `middleware.DefaultSecurityPolicy`
+func WithSecurityPolicy(policy middleware.SecurityPolicy) func(*Config) {
+	return func(c *Config) {
+		c.securityPolicy = policy
+	}
+}
+
+// WithCORS lets the `policy` origins call the API from browsers, no cross-origin requests are allowed by default
+func WithCORS(policy middleware.CORSPolicy) func(*Config) {
+	return func(c *Config) {
+		c.corsPolicy = policy
+	}
+}
+
+func (c Config) tls() bool {
+	return len(c.tlsCertFile) > 0 || len(c.autocertDomains) > 0
+}
+
+func (c Config) LogValue() slog.Value {
 	return slog.GroupValue(
 		slog.Int("port", c.port),
-		slog.String("telegramBotToken", safe(c.telegramBotToken)),
-		slog.String("jwtSecret", safe(c.jwtSecret)),
+		slog.Bool("tls", c.tls()),
+		slog.Any("autocertDomains", c.autocertDomains),
+		slog.Int("redirectPort", c.redirectPort),
+		slog.Duration("readTimeout", c.readTimeout),
+		slog.Duration("writeTimeout", c.writeTimeout),
+		slog.Duration("idleTimeout", c.idleTimeout),
+		slog.String("telegramBotToken", logging.Mask(c.telegramBotToken)),
+		slog.Int("loginBots", len(c.loginBotTokens)),
+		slog.Any("loginBotDomains", c.loginBotDomains),
+		slog.Duration("telegramAuthMaxAge", c.telegramAuthMaxAge),
+		slog.String("jwtSecret", logging.Mask(c.jwtSecret)),
+		slog.Any("jwtKeys", c.jwtKeys),
+		slog.String("jwtIssuer", c.jwtIssuer),
+		slog.String("jwtAudience", c.jwtAudience),
 		slog.String("staticFilesDir", c.staticFilesDir),
+		slog.Bool("embeddedStaticFiles", c.staticFiles != nil),
+		slog.Any("adminTelegramIDs", c.adminTelegramIDs),
+		slog.Duration("accessTokenTTL", c.accessTokenTTL),
+		slog.Duration("refreshTokenTTL", c.refreshTokenTTL),
+		slog.Bool("secureCookies", c.secureCookies),
+		slog.Float64("rateLimit", c.rateLimit),
+		slog.Int("rateLimitBurst", c.rateLimitBurst),
+		slog.Any("trustedProxies", c.trustedProxies),
+		slog.String("metricsToken", logging.Mask(c.metricsToken)),
+		slog.Any("securityPolicy", c.securityPolicy),
+		slog.Any("corsPolicy", c.corsPolicy),
 	)
 }
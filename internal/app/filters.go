@@ -0,0 +1,136 @@
+package app
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"github.com/ailinykh/waitlist/internal/repository"
+)
+
+func NewBlocklistHandlerFunc(logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := repo.GetBlockedUsers(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get blocked users", slog.Any("error", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if users == nil {
+			users = []repository.BlockedUser{}
+		}
+
+		writeJSON(w, users, logger)
+	}
+}
+
+// NewBlockUserHandlerFunc adds (or removes) the `{user_id}` to the blocklist,
+// messages of blocked users are flagged by the bots
+func NewBlockUserHandlerFunc(block bool, logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, user, ok := lookupManagedUser(w, r, logger, repo)
+		if !ok {
+			return
+		}
+
+		var err error
+		if block {
+			var body struct {
+				Reason string `json:"reason"`
+			}
+			// the reason is optional
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+				logger.ErrorContext(r.Context(), "failed to decode request body", slog.Any("error", err))
+				http.Error(w, "Bad Request", http.StatusBadRequest)
+				return
+			}
+
+			_, err = repo.CreateBlockedUser(r.Context(), repository.CreateBlockedUserParams{
+				UserID:    user.UserID,
+				Reason:    body.Reason,
+				BlockedBy: caller.UserID,
+			})
+		} else {
+			_, err = repo.DeleteBlockedUser(r.Context(), user.UserID)
+		}
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to update blocklist", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "user blocklist changed",
+			slog.Int64("user_id", user.UserID),
+			slog.Bool("blocked", block),
+			slog.Int64("changed_by", caller.UserID),
+		)
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func NewBannedWordsHandlerFunc(logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		botUsername := r.PathValue("bot_username")
+
+		words, err := repo.GetBannedWords(r.Context(), botUsername)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get banned words", slog.Any("error", err), slog.String("bot_username", botUsername))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if words == nil {
+			words = []string{}
+		}
+
+		writeJSON(w, words, logger)
+	}
+}
+
+// NewBannedWordHandlerFunc bans (or allows) the `{word}` in messages sent to the `{bot_username}`
+func NewBannedWordHandlerFunc(ban bool, logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		botUsername := r.PathValue("bot_username")
+		word := strings.ToLower(strings.TrimSpace(r.PathValue("word")))
+		if len(word) == 0 {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		var err error
+		if ban {
+			_, err = repo.CreateBannedWord(r.Context(), repository.CreateBannedWordParams{
+				BotUsername: botUsername,
+				Word:        word,
+			})
+		} else {
+			_, err = repo.DeleteBannedWord(r.Context(), repository.DeleteBannedWordParams{
+				BotUsername: botUsername,
+				Word:        word,
+			})
+		}
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to update banned words", slog.Any("error", err), slog.String("bot_username", botUsername))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		words, err := repo.GetBannedWords(r.Context(), botUsername)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get banned words", slog.Any("error", err), slog.String("bot_username", botUsername))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if words == nil {
+			words = []string{}
+		}
+
+		writeJSON(w, words, logger)
+	}
+}
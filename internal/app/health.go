@@ -0,0 +1,43 @@
+package app
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/health"
+)
+
+const readinessTimeout = time.Second * 5
+
+// NewLivenessHandlerFunc only tells the process is able to serve requests
+func NewLivenessHandlerFunc(logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, health.Report{Status: health.StatusOK, Components: map[string]health.Component{}}, logger)
+	}
+}
+
+// NewReadinessHandlerFunc runs the checks and responds with `503` unless every component is healthy.
+// The endpoint is public, so the errors are only logged and the response tells the status of each component.
+func NewReadinessHandlerFunc(checks health.Checks, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		report := checks.Run(r.Context(), readinessTimeout)
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		if report.Status != health.StatusOK {
+			logger.WarnContext(r.Context(), "not ready", slog.Any("report", report))
+			w.WriteHeader(http.StatusServiceUnavailable)
+		}
+
+		for name, component := range report.Components {
+			component.Error = ""
+			report.Components[name] = component
+		}
+
+		if err := json.NewEncoder(w).Encode(report); err != nil {
+			logger.ErrorContext(r.Context(), "failed to encode readiness report", slog.Any("error", err))
+		}
+	}
+}
@@ -0,0 +1,79 @@
+package app_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"os"
+	"testing"
+
+	"github.com/ailinykh/waitlist/internal/app"
+	"github.com/ailinykh/waitlist/internal/database"
+	"github.com/ailinykh/waitlist/internal/health"
+	"github.com/ailinykh/waitlist/internal/repository"
+	h "github.com/ailinykh/waitlist/pkg/http_test"
+)
+
+func TestHealthAPI(t *testing.T) {
+	svr := makeServerMock(t, "test_app_frontend")
+	db := newDb(t)
+	polled := errors.New("no successful run yet")
+	app, err := app.New(slog.Default(), repository.New(db),
+		app.WithTelegramBotEndpoint(svr.URL),
+		app.WithReadinessCheck("database", db.PingContext),
+		app.WithReadinessCheck("migrations", database.Migrated(db, os.DirFS(cwd(t)))),
+		app.WithReadinessCheck("bot:1", func(context.Context) error { return polled }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("it is alive", func(t *testing.T) {
+		var report health.Report
+		h.Expect(t, app).Request(
+			h.WithUrl("/healthz"),
+		).ToRespond(
+			h.WithCode(200),
+			h.WithContentType("application/json"),
+			h.DecodeJSON(&report),
+		)
+
+		if report.Status != health.StatusOK {
+			t.Errorf("expected %s, got %s", health.StatusOK, report.Status)
+		}
+	})
+
+	t.Run("it is not ready until every component is healthy", func(t *testing.T) {
+		var report health.Report
+		h.Expect(t, app).Request(
+			h.WithUrl("/readyz"),
+		).ToRespond(
+			h.WithCode(503),
+			h.WithContentType("application/json"),
+			h.DecodeJSON(&report),
+		)
+
+		if report.Status != health.StatusFail {
+			t.Errorf("expected %s, got %s", health.StatusFail, report.Status)
+		}
+
+		for _, name := range []string{"database", "migrations"} {
+			if c := report.Components[name]; c.Status != health.StatusOK {
+				t.Errorf("expected %s to be ok, got %v", name, c)
+			}
+		}
+
+		if c := report.Components["bot:1"]; c.Status != health.StatusFail || len(c.Error) > 0 {
+			t.Errorf("expected bot to fail without details, got %v", c)
+		}
+	})
+
+	t.Run("it is ready once every component is healthy", func(t *testing.T) {
+		polled = nil
+		h.Expect(t, app).Request(
+			h.WithUrl("/readyz"),
+		).ToRespond(
+			h.WithCode(200),
+		)
+	})
+}
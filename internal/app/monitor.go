@@ -0,0 +1,38 @@
+package app
+
+import (
+	"log/slog"
+	"net/http"
+
+	"github.com/ailinykh/waitlist/internal/middleware"
+)
+
+// NewMonitor only serves the health checks and the metrics, e.g. for a process running the bots without the API.
+// It takes the same options as `New`, the ones of the API are ignored.
+func NewMonitor(logger *slog.Logger, opts ...func(*Config)) (App, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return nil, err
+	}
+
+	logger.Info("creating monitor", slog.Any("config", config))
+
+	router := http.NewServeMux()
+	handleMonitoring(router, config, logger)
+
+	return &appImpl{
+		config: config,
+		logger: logger,
+		stack:  router,
+	}, nil
+}
+
+// handleMonitoring registers `/healthz`, `/readyz` and `/metrics`, the latter only when the token is set
+func handleMonitoring(router *http.ServeMux, config *Config, logger *slog.Logger) {
+	router.HandleFunc("GET /healthz", NewLivenessHandlerFunc(logger))
+	router.HandleFunc("GET /readyz", NewReadinessHandlerFunc(config.readinessChecks, logger))
+
+	if len(config.metricsToken) > 0 {
+		router.Handle("GET /metrics", middleware.HeaderAuth("Authorization", "Bearer "+config.metricsToken, logger)(config.metrics.Handler()))
+	}
+}
@@ -0,0 +1,105 @@
+package app
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/http"
+	"strconv"
+
+	"github.com/ailinykh/waitlist/internal/lifecycle"
+	"golang.org/x/crypto/acme/autocert"
+)
+
+// Run serves until `ctx` is done, then stops accepting connections and waits for the requests
+// in progress until the shutdown times out, see `lifecycle.DrainContext`
+func (app *appImpl) Run(ctx context.Context) error {
+	server := app.newServer(app.config.port, app)
+	servers := []*http.Server{server}
+
+	listen := server.ListenAndServe
+	redirect := newRedirectHandler(app.config.port)
+	switch {
+	case len(app.config.autocertDomains) > 0:
+		manager := &autocert.Manager{
+			Prompt:     autocert.AcceptTOS,
+			HostPolicy: autocert.HostWhitelist(app.config.autocertDomains...),
+			Cache:      autocert.DirCache(app.config.autocertCacheDir),
+			Email:      app.config.autocertEmail,
+		}
+		server.TLSConfig = manager.TLSConfig()
+		// HTTP-01 challenges are answered by the redirect listener, TLS-ALPN-01 ones by the server itself
+		redirect = manager.HTTPHandler(redirect)
+		listen = func() error {
+			return server.ListenAndServeTLS("", "")
+		}
+	case len(app.config.tlsCertFile) > 0:
+		listen = func() error {
+			return server.ListenAndServeTLS(app.config.tlsCertFile, app.config.tlsKeyFile)
+		}
+	}
+
+	done := make(chan error, 2)
+	go func() {
+		done <- listen()
+	}()
+	app.logger.Info("server listening", slog.String("addr", server.Addr), slog.Bool("tls", app.config.tls()))
+
+	if app.config.redirectPort > 0 {
+		redirectServer := app.newServer(app.config.redirectPort, redirect)
+		servers = append(servers, redirectServer)
+		go func() {
+			done <- redirectServer.ListenAndServe()
+		}()
+		app.logger.Info("redirecting to https", slog.String("addr", redirectServer.Addr))
+	}
+
+	var err error
+	select {
+	case err = <-done:
+		err = fmt.Errorf("failed to listen and serve: %w", err)
+	case <-ctx.Done():
+	}
+
+	ctx, cancel := lifecycle.DrainContext(ctx)
+	defer cancel()
+
+	for _, s := range servers {
+		if shutdownErr := s.Shutdown(ctx); shutdownErr != nil && err == nil {
+			s.Close()
+			err = fmt.Errorf("failed to shutdown server: %w", shutdownErr)
+		}
+	}
+
+	if err != nil {
+		return err
+	}
+	app.logger.Info("server stopped")
+	return nil
+}
+
+func (app *appImpl) newServer(port int, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         fmt.Sprintf(":%d", port),
+		Handler:      handler,
+		ReadTimeout:  app.config.readTimeout,
+		WriteTimeout: app.config.writeTimeout,
+		IdleTimeout:  app.config.idleTimeout,
+	}
+}
+
+// newRedirectHandler sends plain HTTP requests to the same host and path over HTTPS,
+// 308 keeps the method and body, e.g. of Telegram webhook calls
+func newRedirectHandler(port int) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host, _, err := net.SplitHostPort(r.Host)
+		if err != nil {
+			host = r.Host
+		}
+		if port != 443 {
+			host = net.JoinHostPort(host, strconv.Itoa(port))
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), http.StatusPermanentRedirect)
+	})
+}
@@ -0,0 +1,163 @@
+package app_test
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/app"
+)
+
+func TestRun(t *testing.T) {
+	t.Run("it serves https and redirects plain http", func(t *testing.T) {
+		certFile, keyFile, pool := makeCertificate(t)
+		port, redirectPort := freePort(t), freePort(t)
+		sut, err := app.New(slog.Default(), nil,
+			app.WithJwtSecret("jwt-secret"),
+			app.WithPort(port),
+			app.WithTLSCertificate(certFile, keyFile),
+			app.WithHTTPRedirect(redirectPort),
+			app.WithTimeouts(time.Second, time.Second, time.Second),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx, cancel := context.WithCancel(t.Context())
+		stopped := make(chan error, 1)
+		go func() {
+			stopped <- sut.Run(ctx)
+		}()
+
+		client := &http.Client{
+			Transport: &http.Transport{TLSClientConfig: &tls.Config{RootCAs: pool}},
+			CheckRedirect: func(*http.Request, []*http.Request) error {
+				return http.ErrUseLastResponse
+			},
+		}
+		res := retry(t, func() (*http.Response, error) {
+			return client.Get(fmt.Sprintf("https://127.0.0.1:%d/healthz", port))
+		})
+		if res.StatusCode != 200 {
+			t.Errorf("expected 200, got %d", res.StatusCode)
+		}
+
+		res = retry(t, func() (*http.Response, error) {
+			return client.Post(fmt.Sprintf("http://127.0.0.1:%d/webhook/bot?a=1", redirectPort), "application/json", strings.NewReader("{}"))
+		})
+		if res.StatusCode != 308 {
+			t.Errorf("expected 308, got %d", res.StatusCode)
+		}
+		if expected, location := fmt.Sprintf("https://127.0.0.1:%d/webhook/bot?a=1", port), res.Header.Get("Location"); location != expected {
+			t.Errorf("expected %s, got %s", expected, location)
+		}
+
+		cancel()
+		if err := <-stopped; err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("it fails when the port is taken", func(t *testing.T) {
+		l, err := net.Listen("tcp", ":0")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer l.Close()
+
+		sut, err := app.New(slog.Default(), nil,
+			app.WithJwtSecret("jwt-secret"),
+			app.WithPort(l.Addr().(*net.TCPAddr).Port),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := sut.Run(t.Context()); err == nil || !strings.Contains(err.Error(), "failed to listen and serve") {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
+
+func freePort(t testing.TB) int {
+	t.Helper()
+	l, err := net.Listen("tcp", ":0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	return l.Addr().(*net.TCPAddr).Port
+}
+
+func retry(t testing.TB, do func() (*http.Response, error)) *http.Response {
+	t.Helper()
+	var err error
+	for range 50 {
+		var res *http.Response
+		if res, err = do(); err == nil {
+			res.Body.Close()
+			return res
+		}
+		time.Sleep(time.Millisecond * 20)
+	}
+	t.Fatal(err)
+	return nil
+}
+
+// makeCertificate writes a self-signed certificate for 127.0.0.1 and returns the pool trusting it
+func makeCertificate(t testing.TB) (string, string, *x509.CertPool) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "waitlist"},
+		IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	keyDer, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: keyDer}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
@@ -0,0 +1,388 @@
+package app
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/middleware"
+	"github.com/ailinykh/waitlist/internal/repository"
+	"github.com/ailinykh/waitlist/pkg/jwt"
+	"github.com/google/uuid"
+)
+
+const (
+	refreshCookie = "refresh_token"
+	// SessionTypeHeader set to `bearer` on login returns the tokens in the body instead of cookies, e.g. for scripts
+	SessionTypeHeader = "X-Session-Type"
+)
+
+type tokenResponse struct {
+	Token        string `json:"token,omitempty"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	ExpiresIn    int64  `json:"expires_in"`
+}
+
+// issueTokens creates a short-lived access token and a refresh token stored server-side as a hash
+func issueTokens(ctx context.Context, config *Config, repo Repo, user repository.User) (*tokenResponse, error) {
+	now := config.clock.Now()
+
+	token, err := signAccessToken(config, user, now, config.accessTokenTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	refreshToken, err := randomToken()
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	_, err = repo.CreateRefreshToken(ctx, repository.CreateRefreshTokenParams{
+		UserID:    user.UserID,
+		TokenHash: hashToken(refreshToken),
+		ExpiresAt: now.Add(config.refreshTokenTTL),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return &tokenResponse{
+		Token:        token,
+		RefreshToken: refreshToken,
+		ExpiresIn:    int64(config.accessTokenTTL.Seconds()),
+	}, nil
+}
+
+func signAccessToken(config *Config, user repository.User, now time.Time, ttl time.Duration) (string, error) {
+	token, err := jwt.Sign(config.jwtKeys, &jwt.Claims[middleware.User]{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    config.jwtIssuer,
+			Subject:   strconv.FormatInt(user.UserID, 10),
+			Audience:  []string{config.jwtAudience},
+			ExpiresAt: jwt.NewNumericDate(now.Add(ttl)),
+			NotBefore: jwt.NewNumericDate(now),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        uuid.NewString(),
+		},
+		Payload: middleware.User{
+			UserID:    user.UserID,
+			FirstName: user.FirstName,
+			LastName:  user.LastName,
+			Username:  user.Username,
+			Role:      user.Role,
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign jwt token: %w", err)
+	}
+	return token, nil
+}
+
+// IssueAccessToken mints an access token for scripts on behalf of an active user, no refresh token is issued.
+// The token is signed the same way `New` does with the same `opts`, and is revoked along with the user ones.
+func IssueAccessToken(ctx context.Context, repo Repo, userID int64, opts ...func(*Config)) (string, error) {
+	config, err := newConfig(opts...)
+	if err != nil {
+		return "", err
+	}
+
+	user, err := repo.GetUserByUserID(ctx, userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", fmt.Errorf("user %d not found, the user has to login first", userID)
+		}
+		return "", fmt.Errorf("failed to get user: %w", err)
+	}
+
+	if !user.Active {
+		return "", fmt.Errorf("user %d is deactivated", userID)
+	}
+
+	return signAccessToken(config, user, config.clock.Now(), config.accessTokenTTL)
+}
+
+func randomToken() (string, error) {
+	data := make([]byte, 32)
+	if _, err := rand.Read(data); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// writeSession hands the tokens to API clients asking for them explicitly. Browser sessions only get them
+// in `HttpOnly` cookies, so a script injected into the page can not read them from a response.
+func writeSession(w http.ResponseWriter, r *http.Request, config *Config, tokens *tokenResponse, bearer bool, logger *slog.Logger) {
+	if bearer {
+		writeJSON(w, tokens, logger)
+		return
+	}
+
+	if err := setSessionCookies(w, config, tokens); err != nil {
+		logger.ErrorContext(r.Context(), "failed to set session cookies", slog.Any("error", err))
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	writeJSON(w, &tokenResponse{ExpiresIn: tokens.ExpiresIn}, logger)
+}
+
+// setSessionCookies keeps tokens out of reach of JavaScript for browser sessions.
+// The CSRF token is readable on purpose, the SPA echoes it back in `X-CSRF-Token` header.
+func setSessionCookies(w http.ResponseWriter, config *Config, tokens *tokenResponse) error {
+	csrf, err := randomToken()
+	if err != nil {
+		return fmt.Errorf("failed to generate csrf token: %w", err)
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.AuthCookie,
+		Value:    tokens.Token,
+		Path:     "/",
+		MaxAge:   int(config.accessTokenTTL.Seconds()),
+		Secure:   config.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookie,
+		Value:    tokens.RefreshToken,
+		Path:     "/",
+		MaxAge:   int(config.refreshTokenTTL.Seconds()),
+		Secure:   config.secureCookies,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+	http.SetCookie(w, &http.Cookie{
+		Name:     middleware.CSRFCookie,
+		Value:    csrf,
+		Path:     "/",
+		MaxAge:   int(config.refreshTokenTTL.Seconds()),
+		Secure:   config.secureCookies,
+		SameSite: http.SameSiteStrictMode,
+	})
+	return nil
+}
+
+func clearSessionCookies(w http.ResponseWriter, config *Config) {
+	for _, name := range []string{middleware.AuthCookie, refreshCookie, middleware.CSRFCookie} {
+		http.SetCookie(w, &http.Cookie{
+			Name:     name,
+			Value:    "",
+			Path:     "/",
+			MaxAge:   -1,
+			Secure:   config.secureCookies,
+			HttpOnly: name != middleware.CSRFCookie,
+			SameSite: http.SameSiteStrictMode,
+		})
+	}
+}
+
+// refreshTokenFromRequest prefers the token passed explicitly in the body over the cookie,
+// reporting whether it came from the body, i.e. the session is a bearer one
+func refreshTokenFromRequest(r *http.Request) (string, bool) {
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err == nil && len(body.RefreshToken) > 0 {
+		return body.RefreshToken, true
+	}
+
+	if cookie, err := r.Cookie(refreshCookie); err == nil {
+		return cookie.Value, false
+	}
+	return "", false
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// revokeUserTokens cuts off all access tokens issued to the user before the current second,
+// and optionally the refresh tokens, so the user has to login again. Tokens issued right after,
+// e.g. refreshed by the SPA once the role changes, are accepted.
+func revokeUserTokens(ctx context.Context, repo Repo, now time.Time, userID int64, refresh bool) error {
+	_, err := repo.CreateTokenRevocation(ctx, repository.CreateTokenRevocationParams{
+		UserID:    userID,
+		RevokedAt: now,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to revoke access tokens: %w", err)
+	}
+
+	if refresh {
+		_, err = repo.RevokeUserRefreshTokens(ctx, repository.RevokeUserRefreshTokensParams{
+			UserID:    userID,
+			RevokedAt: sql.NullTime{Time: now, Valid: true},
+		})
+		if err != nil {
+			return fmt.Errorf("failed to revoke refresh tokens: %w", err)
+		}
+	}
+	return nil
+}
+
+func NewRefreshHandlerFunc(config *Config, repo Repo, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		refreshToken, bearer := refreshTokenFromRequest(r)
+		if len(refreshToken) == 0 {
+			logger.ErrorContext(r.Context(), "no refresh token passed")
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		rt, err := repo.GetRefreshTokenByHash(r.Context(), hashToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, sql.ErrNoRows) {
+				logger.ErrorContext(r.Context(), "unknown refresh token")
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			} else {
+				logger.ErrorContext(r.Context(), "failed to find refresh token", slog.Any("error", err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			}
+			return
+		}
+
+		now := config.clock.Now()
+
+		if rt.RevokedAt.Valid {
+			// a rotated token is used again, so either the client or an attacker holds a stolen copy
+			logger.WarnContext(r.Context(), "refresh token reuse detected", slog.Int64("user_id", rt.UserID))
+			if err := revokeUserTokens(r.Context(), repo, now, rt.UserID, true); err != nil {
+				logger.ErrorContext(r.Context(), "failed to revoke tokens", slog.Any("error", err), slog.Int64("user_id", rt.UserID))
+			}
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if rt.ExpiresAt.Before(now) {
+			logger.ErrorContext(r.Context(), "refresh token expired", slog.Int64("user_id", rt.UserID))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		res, err := repo.RevokeRefreshToken(r.Context(), repository.RevokeRefreshTokenParams{
+			ID:        rt.ID,
+			RevokedAt: sql.NullTime{Time: now, Valid: true},
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to rotate refresh token", slog.Any("error", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		// concurrent refresh with the same token
+		if n, _ := res.RowsAffected(); n != 1 {
+			logger.ErrorContext(r.Context(), "refresh token already rotated", slog.Int64("user_id", rt.UserID))
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		user, err := repo.GetUserByUserID(r.Context(), rt.UserID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to find user by id", slog.Any("error", err), slog.Int64("user_id", rt.UserID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if !user.Active {
+			logger.ErrorContext(r.Context(), "inactive user attempt to refresh token", slog.Int64("user_id", user.UserID))
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		tokens, err := issueTokens(r.Context(), config, repo, user)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to issue tokens", slog.Any("error", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeSession(w, r, config, tokens, bearer, logger)
+	}
+}
+
+// NewLogoutHandlerFunc revokes the refresh token and clears session cookies,
+// it only accepts POST, so the CSRF protection applies
+func NewLogoutHandlerFunc(config *Config, repo Repo, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		clearSessionCookies(w, config)
+
+		refreshToken, _ := refreshTokenFromRequest(r)
+		rt, err := repo.GetRefreshTokenByHash(r.Context(), hashToken(refreshToken))
+		if err != nil {
+			if !errors.Is(err, sql.ErrNoRows) {
+				logger.ErrorContext(r.Context(), "failed to find refresh token", slog.Any("error", err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			// nothing to revoke, logout is idempotent
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		_, err = repo.RevokeRefreshToken(r.Context(), repository.RevokeRefreshTokenParams{
+			ID:        rt.ID,
+			RevokedAt: sql.NullTime{Time: config.clock.Now(), Valid: true},
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to revoke refresh token", slog.Any("error", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "user logged out", slog.Int64("user_id", rt.UserID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// NewRevokeHandlerFunc immediately cuts off a compromised user
+func NewRevokeHandlerFunc(config *Config, repo Repo, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to parse user_id", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if err := revokeUserTokens(r.Context(), repo, config.clock.Now(), userID, true); err != nil {
+			logger.ErrorContext(r.Context(), "failed to revoke tokens", slog.Any("error", err), slog.Int64("user_id", userID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "user tokens revoked", slog.Int64("user_id", userID))
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// revocationList adapts `Repo` to `middleware.RevocationList`
+type revocationList struct {
+	repo Repo
+}
+
+func (l revocationList) IsRevoked(ctx context.Context, userID int64, issuedAt time.Time) (bool, error) {
+	return l.repo.IsTokenRevoked(ctx, repository.IsTokenRevokedParams{
+		UserID:    userID,
+		RevokedAt: issuedAt,
+	})
+}
+
+// NewJWKSHandlerFunc publishes public keys, so other services can verify issued tokens
+func NewJWKSHandlerFunc(keys *jwt.KeySet, logger *slog.Logger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		writeJSON(w, keys.JWKS(), logger)
+	}
+}
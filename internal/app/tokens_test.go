@@ -0,0 +1,318 @@
+package app_test
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/app"
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/permission"
+	"github.com/ailinykh/waitlist/internal/repository"
+	h "github.com/ailinykh/waitlist/pkg/http_test"
+)
+
+type tokens struct {
+	Token        string `json:"token"`
+	RefreshToken string `json:"refresh_token"`
+}
+
+func TestRefreshTokens(t *testing.T) {
+	svr := makeServerMock(t, "test_jwt_authorization_logic")
+	// RFC3339Nano "2006-01-02T15:04:05.999999999Z07:00"
+	clk := clock.NewFake(clock.MustParse("2013-08-14T22:00:00.123456789Z"))
+	app, repo := makeSUT(t,
+		app.WithJwtSecret("jwt-secret"),
+		app.WithTelegramBotToken("telegram-secret"),
+		app.WithTelegramBotEndpoint(svr.URL),
+		app.WithAdminTelegramIDs(11),
+		app.WithClock(clk),
+	)
+
+	// every login needs a fresh payload, as the used ones are rejected
+	authDate := 1376517600
+	login := func(t *testing.T) tokens {
+		t.Helper()
+		authDate--
+		var resp tokens
+		h.Expect(t, app).Request(
+			h.WithUrl(loginURL(t, fmt.Sprintf("id=11&first_name=cat&last_name=person&username=ilovecats&auth_date=%d", authDate))),
+			h.WithHeader("X-Session-Type", "bearer"),
+		).ToRespond(
+			h.WithCode(200),
+			h.DecodeJSON(&resp),
+		)
+		return resp
+	}
+
+	// refresh builds request body for both refresh and logout endpoints
+	refresh := func(refreshToken string) []byte {
+		return []byte(`{"refresh_token":"` + refreshToken + `"}`)
+	}
+
+	first := login(t)
+	var second tokens
+
+	t.Run("it rotates refresh token", func(t *testing.T) {
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithData(refresh(first.RefreshToken)),
+		).ToRespond(
+			h.WithCode(200),
+			h.DecodeJSON(&second),
+		)
+
+		if len(second.RefreshToken) == 0 || second.RefreshToken == first.RefreshToken {
+			t.Errorf("expected new refresh token, got '%s'", second.RefreshToken)
+		}
+	})
+
+	t.Run("it accepts refreshed access token", func(t *testing.T) {
+		h.Expect(t, app).Request(
+			h.WithUrl("/api/entries"),
+			h.WithHeader("Authorization", "Bearer "+second.Token),
+		).ToRespond(
+			h.WithCode(200),
+		)
+	})
+
+	t.Run("it rejects unknown refresh token", func(t *testing.T) {
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithData(refresh("unknown")),
+		).ToRespond(
+			h.WithCode(401),
+		)
+	})
+
+	t.Run("it revokes all tokens when rotated refresh token is reused", func(t *testing.T) {
+		// tokens issued in the second of the revocation are kept
+		clk.Add(time.Second)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithData(refresh(first.RefreshToken)),
+		).ToRespond(
+			h.WithCode(401),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithData(refresh(second.RefreshToken)),
+		).ToRespond(
+			h.WithCode(401),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithUrl("/api/entries"),
+			h.WithHeader("Authorization", "Bearer "+second.Token),
+		).ToRespond(
+			h.WithCode(401),
+		)
+	})
+
+	t.Run("it revokes refresh token on logout", func(t *testing.T) {
+		third := login(t)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/logout"),
+			h.WithData(refresh(third.RefreshToken)),
+		).ToRespond(
+			h.WithCode(204),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithData(refresh(third.RefreshToken)),
+		).ToRespond(
+			h.WithCode(401),
+		)
+	})
+
+	t.Run("it authenticates browser session with cookies", func(t *testing.T) {
+		session := login(t)
+
+		h.Expect(t, app).Request(
+			h.WithUrl("/api/entries"),
+			h.WithHeader("Cookie", "auth="+session.Token),
+		).ToRespond(
+			h.WithCode(200),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithHeader("Cookie", "refresh_token="+session.RefreshToken),
+		).ToRespond(
+			h.WithCode(403),
+		)
+
+		var refreshed tokens
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithHeader("Cookie", "refresh_token="+session.RefreshToken+"; csrf_token=csrf"),
+			h.WithHeader("X-CSRF-Token", "csrf"),
+		).ToRespond(
+			h.WithCode(200),
+			h.WithCookie("auth"),
+			h.WithCookie("refresh_token"),
+			h.WithCookie("csrf_token"),
+			h.DecodeJSON(&refreshed),
+		)
+
+		// a script reading the csrf cookie must not get the tokens out of the response
+		if len(refreshed.Token) > 0 || len(refreshed.RefreshToken) > 0 {
+			t.Errorf("unexpected tokens in body %+v", refreshed)
+		}
+	})
+
+	t.Run("it clears session cookies on logout", func(t *testing.T) {
+		session := login(t)
+
+		h.Expect(t, app).Request(
+			h.WithUrl("/logout"),
+			h.WithHeader("Cookie", "auth="+session.Token+"; refresh_token="+session.RefreshToken),
+		).ToRespond(
+			h.WithCode(404),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/logout"),
+			h.WithHeader("Cookie", "auth="+session.Token+"; refresh_token="+session.RefreshToken+"; csrf_token=csrf"),
+			h.WithHeader("X-CSRF-Token", "csrf"),
+		).ToRespond(
+			h.WithCode(204),
+			h.WithCookie("auth", ""),
+			h.WithCookie("refresh_token", ""),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithData(refresh(session.RefreshToken)),
+		).ToRespond(
+			h.WithCode(401),
+		)
+	})
+
+	t.Run("it accepts tokens refreshed in the second of a revocation", func(t *testing.T) {
+		session := login(t)
+
+		// e.g. a role change, the refresh tokens are kept
+		if _, err := repo.CreateTokenRevocation(t.Context(), repository.CreateTokenRevocationParams{UserID: 11, RevokedAt: clk.Now()}); err != nil {
+			t.Fatal(err)
+		}
+
+		var refreshed tokens
+		h.Expect(t, app).Request(
+			h.WithMethod(http.MethodPost),
+			h.WithUrl("/api/auth/refresh"),
+			h.WithData(refresh(session.RefreshToken)),
+		).ToRespond(
+			h.WithCode(200),
+			h.DecodeJSON(&refreshed),
+		)
+
+		h.Expect(t, app).Request(
+			h.WithUrl("/api/entries"),
+			h.WithHeader("Authorization", "Bearer "+refreshed.Token),
+		).ToRespond(
+			h.WithCode(200),
+		)
+
+		if _, err := repo.CreateTokenRevocation(t.Context(), repository.CreateTokenRevocationParams{UserID: 11, RevokedAt: clk.Now().Add(time.Second)}); err != nil {
+			t.Fatal(err)
+		}
+
+		h.Expect(t, app).Request(
+			h.WithUrl("/api/entries"),
+			h.WithHeader("Authorization", "Bearer "+refreshed.Token),
+		).ToRespond(
+			h.WithCode(401),
+		)
+	})
+}
+
+func TestIssueAccessToken(t *testing.T) {
+	svr := makeServerMock(t, "test_jwt_authorization_logic")
+	now := clock.MustParse("2013-08-14T22:00:00.123456789Z")
+	opts := []func(*app.Config){
+		app.WithJwtSecret("jwt-secret"),
+		app.WithTelegramBotToken("telegram-secret"),
+		app.WithTelegramBotEndpoint(svr.URL),
+		app.WithAdminTelegramIDs(11),
+		app.WithClock(clock.New(clock.WithTime(now))),
+	}
+	sut, repo := makeSUT(t, opts...)
+
+	h.Expect(t, sut).Request(
+		h.WithUrl(loginURL(t, "id=11&first_name=cat&last_name=person&username=ilovecats&auth_date=1376517600")),
+	).ToRespond(
+		h.WithCode(200),
+	)
+
+	t.Run("it issues token accepted by the API", func(t *testing.T) {
+		token, err := app.IssueAccessToken(context.Background(), repo, 11, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims := decodeToken(t, token, now); claims.Payload.Role != permission.RoleAdmin {
+			t.Errorf("expected role %s, got %s", permission.RoleAdmin, claims.Payload.Role)
+		}
+
+		h.Expect(t, sut).Request(
+			h.WithUrl("/api/users"),
+			h.WithHeader("Authorization", "Bearer "+token),
+		).ToRespond(
+			h.WithCode(200),
+		)
+	})
+
+	t.Run("it carries the changed role", func(t *testing.T) {
+		user, err := repo.GetUserByUserID(context.Background(), 11)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := app.ChangeUserRole(context.Background(), repo, now, user, permission.RoleViewer, app.SystemUserID); err != nil {
+			t.Fatal(err)
+		}
+
+		token, err := app.IssueAccessToken(context.Background(), repo, 11, opts...)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims := decodeToken(t, token, now); claims.Payload.Role != permission.RoleViewer {
+			t.Errorf("expected role %s, got %s", permission.RoleViewer, claims.Payload.Role)
+		}
+	})
+
+	t.Run("it rejects unknown role", func(t *testing.T) {
+		user, err := repo.GetUserByUserID(context.Background(), 11)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := app.ChangeUserRole(context.Background(), repo, now, user, "root", app.SystemUserID); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("it fails for unknown user", func(t *testing.T) {
+		if _, err := app.IssueAccessToken(context.Background(), repo, 12, opts...); err == nil {
+			t.Error("expected error")
+		}
+	})
+}
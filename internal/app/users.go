@@ -0,0 +1,277 @@
+package app
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/middleware"
+	"github.com/ailinykh/waitlist/internal/permission"
+	"github.com/ailinykh/waitlist/internal/repository"
+)
+
+// SystemUserID is recorded as the author of role changes made by the app itself,
+// e.g. when a user listed in `ADMIN_TELEGRAM_IDS` logs in for the first time.
+const SystemUserID int64 = 0
+
+func NewUsersHandlerFunc(logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		users, err := repo.GetAllUsers(r.Context())
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get users", slog.Any("error", err))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, users, logger)
+	}
+}
+
+func NewUserRoleHandlerFunc(clock clock.Clock, logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		var body struct {
+			Role string `json:"role"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			logger.ErrorContext(r.Context(), "failed to decode request body", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		if !slices.Contains(permission.Roles(), body.Role) {
+			logger.ErrorContext(r.Context(), "unknown role", slog.String("role", body.Role))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		caller, user, ok := lookupManagedUser(w, r, logger, repo)
+		if !ok {
+			return
+		}
+
+		if user.Role != body.Role {
+			if err := ChangeUserRole(r.Context(), repo, clock.Now(), *user, body.Role, caller.UserID); err != nil {
+				logger.ErrorContext(r.Context(), "failed to change user role", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			logger.InfoContext(r.Context(), "user role changed",
+				slog.Int64("user_id", user.UserID),
+				slog.String("old_role", user.Role),
+				slog.String("new_role", body.Role),
+				slog.Int64("changed_by", caller.UserID),
+			)
+			user.Role = body.Role
+		}
+
+		writeJSON(w, user, logger)
+	}
+}
+
+// ChangeUserRole updates the role, records the change in the audit log and revokes the access tokens in one transaction,
+// the new role is picked up on the next token refresh.
+// Changes made outside of the API, e.g. from the command line, are authored by `SystemUserID`.
+func ChangeUserRole(ctx context.Context, repo Repo, now time.Time, user repository.User, role string, changedBy int64) error {
+	if !slices.Contains(permission.Roles(), role) {
+		return fmt.Errorf("unknown role %q, expected one of %s", role, strings.Join(permission.Roles(), ", "))
+	}
+
+	return repo.InTx(ctx, func(q *repository.Queries) error {
+		_, err := q.UpdateUserRole(ctx, repository.UpdateUserRoleParams{
+			UserID: user.UserID,
+			Role:   role,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to update user role: %w", err)
+		}
+
+		_, err = q.CreateRoleChange(ctx, repository.CreateRoleChangeParams{
+			UserID:    user.UserID,
+			OldRole:   user.Role,
+			NewRole:   role,
+			ChangedBy: changedBy,
+		})
+		if err != nil {
+			return fmt.Errorf("failed to record role change: %w", err)
+		}
+
+		return revokeUserTokens(ctx, q, now, user.UserID, false)
+	})
+}
+
+func NewUserActiveHandlerFunc(active bool, clock clock.Clock, logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, user, ok := lookupManagedUser(w, r, logger, repo)
+		if !ok {
+			return
+		}
+
+		_, err := repo.UpdateUserActive(r.Context(), repository.UpdateUserActiveParams{
+			UserID: user.UserID,
+			Active: active,
+		})
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to update user", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if !active {
+			if err := revokeUserTokens(r.Context(), repo, clock.Now(), user.UserID, true); err != nil {
+				logger.ErrorContext(r.Context(), "failed to revoke tokens", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		logger.InfoContext(r.Context(), "user active state changed",
+			slog.Int64("user_id", user.UserID),
+			slog.Bool("active", active),
+			slog.Int64("changed_by", caller.UserID),
+		)
+		user.Active = active
+
+		writeJSON(w, user, logger)
+	}
+}
+
+func NewUserAuditHandlerFunc(logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to parse user_id", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		changes, err := repo.GetRoleChangesByUserID(r.Context(), userID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get role changes", slog.Any("error", err), slog.Int64("user_id", userID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, changes, logger)
+	}
+}
+
+func NewUserBotsHandlerFunc(logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		userID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to parse user_id", slog.Any("error", err))
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+
+		bots, err := repo.GetUserBots(r.Context(), userID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get user bots", slog.Any("error", err), slog.Int64("user_id", userID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, bots, logger)
+	}
+}
+
+// NewUserBotHandlerFunc grants (or revokes) access to the `{bot_username}` entries
+func NewUserBotHandlerFunc(grant bool, logger *slog.Logger, repo Repo) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		caller, user, ok := lookupManagedUser(w, r, logger, repo)
+		if !ok {
+			return
+		}
+
+		botUsername := r.PathValue("bot_username")
+
+		var err error
+		if grant {
+			_, err = repo.CreateUserBot(r.Context(), repository.CreateUserBotParams{
+				UserID:      user.UserID,
+				BotUsername: botUsername,
+			})
+		} else {
+			_, err = repo.DeleteUserBot(r.Context(), repository.DeleteUserBotParams{
+				UserID:      user.UserID,
+				BotUsername: botUsername,
+			})
+		}
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to update user bots", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		logger.InfoContext(r.Context(), "user bot access changed",
+			slog.Int64("user_id", user.UserID),
+			slog.String("bot_username", botUsername),
+			slog.Bool("granted", grant),
+			slog.Int64("changed_by", caller.UserID),
+		)
+
+		bots, err := repo.GetUserBots(r.Context(), user.UserID)
+		if err != nil {
+			logger.ErrorContext(r.Context(), "failed to get user bots", slog.Any("error", err), slog.Int64("user_id", user.UserID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, bots, logger)
+	}
+}
+
+// lookupManagedUser resolves the user from the `{user_id}` path value and makes sure
+// the caller is not trying to manage their own account, which could lock them out.
+func lookupManagedUser(w http.ResponseWriter, r *http.Request, logger *slog.Logger, repo Repo) (*middleware.User, *repository.User, bool) {
+	userID, err := strconv.ParseInt(r.PathValue("user_id"), 10, 64)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to parse user_id", slog.Any("error", err))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	caller, err := middleware.UserFromContext(r.Context())
+	if err != nil {
+		logger.ErrorContext(r.Context(), "failed to read user from context", slog.Any("error", err))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	if caller.UserID == userID {
+		logger.ErrorContext(r.Context(), "attempt to manage own account", slog.Int64("user_id", userID))
+		http.Error(w, "Bad Request", http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	user, err := repo.GetUserByUserID(r.Context(), userID)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			http.Error(w, "Not Found", http.StatusNotFound)
+		} else {
+			logger.ErrorContext(r.Context(), "failed to find user by id", slog.Any("error", err), slog.Int64("user_id", userID))
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		}
+		return nil, nil, false
+	}
+
+	return caller, &user, true
+}
+
+func writeJSON(w http.ResponseWriter, v any, logger *slog.Logger) {
+	w.Header().Set("Content-Type", "application/json")
+
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Error("failed to marshal response", slog.Any("error", err))
+	}
+}
@@ -3,75 +3,259 @@ package app
 import (
 	"context"
 	"log/slog"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/ailinykh/waitlist/internal/api/telegram"
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/filter"
+	"github.com/ailinykh/waitlist/internal/health"
+	"github.com/ailinykh/waitlist/internal/lifecycle"
+	"github.com/ailinykh/waitlist/internal/metrics"
+	"github.com/ailinykh/waitlist/internal/permission"
+	"github.com/ailinykh/waitlist/internal/ratelimit"
 	"github.com/ailinykh/waitlist/internal/repository"
+	"github.com/ailinykh/waitlist/internal/tracing"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
 )
 
-func NewWaitlist(bot *telegram.Bot, repo Repo, logger *slog.Logger) *Waitlist {
-	return &Waitlist{
+func NewWaitlist(bot *telegram.Bot, repo Repo, logger *slog.Logger, opts ...func(*Waitlist)) *Waitlist {
+	w := &Waitlist{
 		bot:    bot,
 		offset: 0,
 		repo:   repo,
 		l:      logger,
+		tracer: noop.NewTracerProvider().Tracer(tracing.Name),
+		clock:  clock.New(),
+	}
+
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	if w.limiter == nil {
+		w.limiter = ratelimit.New(0.1, 5, w.clock)
+	}
+	if w.filters == nil {
+		w.filters = filter.Chain{
+			filter.Blocklist(repo),
+			filter.MaxLength(1024),
+			filter.Links(),
+			filter.BannedWords(repo),
+			filter.Repeats(repo, 3, time.Hour, w.clock),
+		}
+	}
+	return w
+}
+
+// WithBotClock replaces the clock the default per-user rate limit and repeated messages filter count time with
+func WithBotClock(clock clock.Clock) func(*Waitlist) {
+	return func(w *Waitlist) {
+		w.clock = clock
+	}
+}
+
+// WithUserRateLimit limits messages saved per Telegram user, the rest are dropped
+func WithUserRateLimit(limiter *ratelimit.Limiter) func(*Waitlist) {
+	return func(w *Waitlist) {
+		w.limiter = limiter
+	}
+}
+
+// WithBotMetrics reports received updates, saved entries, sent messages and Telegram API failures
+func WithBotMetrics(m *metrics.Metrics) func(*Waitlist) {
+	return func(w *Waitlist) {
+		w.metrics = m
+	}
+}
+
+// WithBotTracing starts a span for every poll and a separate trace for every update
+func WithBotTracing(tp trace.TracerProvider) func(*Waitlist) {
+	return func(w *Waitlist) {
+		w.tracer = tp.Tracer(tracing.Name)
+	}
+}
+
+// WithHeartbeat beats after every successful poll, so readiness can tell the bot is alive
+func WithHeartbeat(heartbeat *health.Heartbeat) func(*Waitlist) {
+	return func(w *Waitlist) {
+		w.beat = heartbeat
+	}
+}
+
+// WithFilters replaces the default filter chain messages are checked with before they are saved
+func WithFilters(filters filter.Filter) func(*Waitlist) {
+	return func(w *Waitlist) {
+		w.filters = filters
 	}
 }
 
 type Waitlist struct {
-	bot    *telegram.Bot
-	offset int64
-	repo   Repo
-	l      *slog.Logger
+	bot     *telegram.Bot
+	offset  int64
+	repo    Repo
+	l       *slog.Logger
+	limiter *ratelimit.Limiter
+	filters filter.Filter
+	metrics *metrics.Metrics
+	tracer  trace.Tracer
+	beat    *health.Heartbeat
+	clock   clock.Clock
 }
 
-func (w *Waitlist) Run(ctx context.Context) error {
-	updates, err := w.bot.GetUpdates(w.offset, 100)
+// Run polls the updates once. Once received, the updates are handled to the end even if `ctx` is done meanwhile,
+// until the shutdown times out, see `lifecycle.DrainContext`. The update failing stops the batch, it is counted
+// as handled along with the ones before it, so an update failing every time does not stop the bot.
+func (w *Waitlist) Run(ctx context.Context) (err error) {
+	ctx, span := w.tracer.Start(ctx, "waitlist.poll", trace.WithAttributes(attribute.String("telegram.bot", w.bot.Username)))
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
+	start := time.Now()
+	updates, err := w.bot.GetUpdates(ctx, w.offset, 100)
+	w.metrics.ObservePoll(w.bot.Username, time.Since(start))
 	if err != nil {
-		w.l.Error("failed to get updates", "error", err)
+		w.metrics.TelegramAPIError(w.bot.Username, "getUpdates")
+		w.l.ErrorContext(ctx, "failed to get updates", "error", err)
 		return err
 	}
 
-	w.l.Info("got updates", "count", len(updates))
+	w.beat.Beat()
+	w.l.InfoContext(ctx, "got updates", "count", len(updates))
+	w.metrics.UpdatesReceived(w.bot.Username, len(updates))
+	span.SetAttributes(attribute.Int("telegram.updates", len(updates)))
+
+	ctx, cancel := lifecycle.DrainContext(ctx)
+	defer cancel()
 
 	for _, u := range updates {
 		w.offset = u.ID + 1
 
-		if u.Message == nil {
-			w.l.Info("ignoring non-message update", "id", u.ID)
-			continue
+		if err := w.handle(ctx, u); err != nil {
+			return err
 		}
+	}
+	return nil
+}
 
-		if strings.TrimPrefix(u.Message.Text, "/") == "ping" {
-			w.l.Info("ping message received", "id", u.ID)
-			_, err := w.bot.SendMessage(u.Message.Chat.ID, "pong")
-			if err != nil {
-				w.l.Error("failed to send message", "error", err)
-				return err
-			}
-		}
+// Commit confirms the handled updates, Telegram would deliver them again to the next poller otherwise
+func (w *Waitlist) Commit(ctx context.Context) error {
+	if w.offset == 0 {
+		return nil
+	}
 
-		arg := repository.CreateEntryParams{
-			UserID:      u.Message.From.ID,
-			FirstName:   u.Message.From.FirstName,
-			LastName:    u.Message.From.LastName,
-			Username:    u.Message.From.Username,
-			Message:     u.Message.Text,
-			BotUsername: w.bot.Username,
-		}
+	if _, err := w.bot.GetUpdates(ctx, w.offset, 0); err != nil {
+		w.metrics.TelegramAPIError(w.bot.Username, "getUpdates")
+		w.l.ErrorContext(ctx, "failed to commit offset", "error", err, "offset", w.offset)
+		return err
+	}
+	w.l.InfoContext(ctx, "offset committed", "offset", w.offset)
+	return nil
+}
 
-		if _, err := w.repo.CreateEntry(ctx, arg); err != nil {
-			w.l.Error("failed to create entry", "error", err)
+// handle processes a single update in its own trace, linked to the poll it came from
+func (w *Waitlist) handle(ctx context.Context, u *telegram.Update) (err error) {
+	ctx, span := w.tracer.Start(ctx, "waitlist.update",
+		trace.WithNewRoot(),
+		trace.WithLinks(trace.LinkFromContext(ctx)),
+		trace.WithAttributes(
+			attribute.String("telegram.bot", w.bot.Username),
+			attribute.Int64("telegram.update_id", u.ID),
+		),
+	)
+	defer func() {
+		tracing.Fail(span, err)
+		span.End()
+	}()
+
+	if u.Message == nil {
+		w.l.InfoContext(ctx, "ignoring non-message update", "id", u.ID)
+		return nil
+	}
+
+	if ok, _ := w.limiter.Allow(strconv.FormatInt(u.Message.From.ID, 10)); !ok {
+		w.l.WarnContext(ctx, "rate limit exceeded, ignoring message", "id", u.ID, "user_id", u.Message.From.ID)
+		return nil
+	}
+
+	reason, err := w.filters.Check(ctx, filter.Message{
+		UserID:      u.Message.From.ID,
+		BotUsername: w.bot.Username,
+		Text:        u.Message.Text,
+		Entities:    entityTypes(u.Message),
+	})
+	if err != nil {
+		w.l.ErrorContext(ctx, "failed to check message", "error", err)
+		return err
+	}
+
+	// flagged messages are saved for review, but the bot does not respond to them
+	flagged := len(reason) > 0
+	if flagged {
+		w.l.WarnContext(ctx, "message flagged", "id", u.ID, "user_id", u.Message.From.ID, "reason", reason)
+		span.SetAttributes(attribute.String("waitlist.flag_reason", reason))
+	}
+
+	if !flagged && strings.TrimPrefix(u.Message.Text, "/") == "ping" {
+		w.l.InfoContext(ctx, "ping message received", "id", u.ID)
+		if err := w.sendMessage(ctx, u.Message.Chat.ID, "pong"); err != nil {
 			return err
 		}
+	}
 
-		if strings.HasPrefix(u.Message.Text, "/start") {
-			_, err := w.bot.SendMessage(u.Message.Chat.ID, "This bot is not available in your region yet. Please come back later.")
-			if err != nil {
-				w.l.Error("failed to send message", "error", err)
-				return err
-			}
+	_, err = w.repo.UpsertUser(ctx, repository.UpsertUserParams{
+		UserID:    u.Message.From.ID,
+		FirstName: u.Message.From.FirstName,
+		LastName:  u.Message.From.LastName,
+		Username:  u.Message.From.Username,
+		Role:      permission.RoleUser,
+	})
+	if err != nil {
+		w.l.ErrorContext(ctx, "failed to upsert user", "error", err)
+		return err
+	}
+
+	arg := repository.CreateEntryParams{
+		UserID:      u.Message.From.ID,
+		Message:     u.Message.Text,
+		BotUsername: w.bot.Username,
+		Flagged:     flagged,
+		FlagReason:  reason,
+	}
+
+	if _, err := w.repo.CreateEntry(ctx, arg); err != nil {
+		w.l.ErrorContext(ctx, "failed to create entry", "error", err)
+		return err
+	}
+	w.metrics.EntryCreated(w.bot.Username, flagged)
+
+	if !flagged && strings.HasPrefix(u.Message.Text, "/start") {
+		if err := w.sendMessage(ctx, u.Message.Chat.ID, "This bot is not available in your region yet. Please come back later."); err != nil {
+			return err
 		}
 	}
 	return nil
 }
+
+func (w *Waitlist) sendMessage(ctx context.Context, chatID int64, text string) error {
+	if _, err := w.bot.SendMessage(ctx, chatID, text); err != nil {
+		w.metrics.TelegramAPIError(w.bot.Username, "sendMessage")
+		w.l.ErrorContext(ctx, "failed to send message", "error", err)
+		return err
+	}
+	w.metrics.MessageSent(w.bot.Username)
+	return nil
+}
+
+func entityTypes(m *telegram.Message) []string {
+	types := []string{}
+	for _, e := range m.Entities {
+		types = append(types, e.Type)
+	}
+	return types
+}
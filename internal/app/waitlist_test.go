@@ -1,18 +1,31 @@
 package app_test
 
 import (
+	"context"
+	"database/sql"
+	"errors"
+	"io"
 	"log/slog"
+	"net/http"
+	"net/http/httptest"
 	"testing"
 
 	"github.com/ailinykh/waitlist/internal/api/telegram"
 	"github.com/ailinykh/waitlist/internal/app"
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/filter"
+	"github.com/ailinykh/waitlist/internal/ratelimit"
 	"github.com/ailinykh/waitlist/internal/repository"
+	"github.com/ailinykh/waitlist/internal/tracing"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	"go.opentelemetry.io/otel/trace"
 )
 
 func TestWaitlistSavesUserInTheDatabase(t *testing.T) {
 	svr := makeServerMock(t, "test_waitlist")
 	repo := repository.New(newDb(t))
-	bot, err := telegram.NewBot("Token:1234", svr.URL, slog.Default())
+	bot, err := telegram.NewBot(t.Context(), "Token:1234", svr.URL, slog.Default())
 	if err != nil {
 		t.Fatal(err)
 	}
@@ -41,6 +54,15 @@ func TestWaitlistSavesUserInTheDatabase(t *testing.T) {
 		if entries[0].Message != "/start" {
 			t.Errorf("Unexpected message %s", entries[0].Message)
 		}
+
+		user, err := repo.GetUserByUserID(t.Context(), 12345)
+		if err != nil {
+			t.Fatalf("failed to get user %s", err)
+		}
+
+		if user.FirstName != "John" || user.LastName != "Appleseed" {
+			t.Errorf("Unexpected user %v", user)
+		}
 	})
 
 	t.Run("it saves one more message in the database", func(t *testing.T) {
@@ -64,7 +86,7 @@ func TestWaitlistRespondsToPrivateMessage(t *testing.T) {
 	t.Run("it accepts different command formats and responds with message", func(t *testing.T) {
 		svr := makeServerMock(t, "test_waitlist")
 		repo := repository.New(newDb(t))
-		bot, err := telegram.NewBot("Token:1234", svr.URL, slog.Default())
+		bot, err := telegram.NewBot(t.Context(), "Token:1234", svr.URL, slog.Default())
 		if err != nil {
 			t.Fatal(err)
 		}
@@ -75,3 +97,245 @@ func TestWaitlistRespondsToPrivateMessage(t *testing.T) {
 		}
 	})
 }
+
+func TestWaitlistTracesUpdates(t *testing.T) {
+	svr := makeServerMock(t, "test_waitlist")
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	repo := repository.New(tracing.WrapDB(newDb(t), tp))
+	bot, err := telegram.NewBot(t.Context(), "Token:1234", svr.URL, slog.Default(), telegram.WithTracerProvider(tp))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitlist := app.NewWaitlist(bot, repo, slog.Default(), app.WithBotTracing(tp))
+	exporter.Reset()
+
+	t.Run("it traces every update separately from the poll", func(t *testing.T) {
+		if err := waitlist.Run(t.Context()); err != nil {
+			t.Fatalf("failed to run waitlist logic %s", err)
+		}
+
+		spans := map[string]tracetest.SpanStub{}
+		for _, s := range exporter.GetSpans() {
+			spans[s.Name] = s
+		}
+
+		poll, ok := spans["waitlist.poll"]
+		if !ok {
+			t.Fatalf("expected poll span, got %v", spans)
+		}
+
+		update, ok := spans["waitlist.update"]
+		if !ok {
+			t.Fatalf("expected update span, got %v", spans)
+		}
+
+		if update.SpanContext.TraceID() == poll.SpanContext.TraceID() {
+			t.Errorf("expected update to start a new trace")
+		}
+
+		if len(update.Links) != 1 || update.Links[0].SpanContext.SpanID() != poll.SpanContext.SpanID() {
+			t.Errorf("expected update to be linked to the poll, got %v", update.Links)
+		}
+
+		for name, traceID := range map[string]trace.TraceID{
+			"telegram.getUpdates":  poll.SpanContext.TraceID(),
+			"telegram.sendMessage": update.SpanContext.TraceID(),
+			"db.UpsertUser":        update.SpanContext.TraceID(),
+			"db.CreateEntry":       update.SpanContext.TraceID(),
+		} {
+			span, ok := spans[name]
+			if !ok {
+				t.Errorf("expected %s span", name)
+				continue
+			}
+
+			if span.SpanContext.TraceID() != traceID {
+				t.Errorf("expected %s span in trace %s, got %s", name, traceID, span.SpanContext.TraceID())
+			}
+		}
+	})
+}
+
+func TestWaitlistLimitsMessagesPerUser(t *testing.T) {
+	svr := makeServerMock(t, "test_waitlist")
+	repo := repository.New(newDb(t))
+	bot, err := telegram.NewBot(t.Context(), "Token:1234", svr.URL, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	limiter := ratelimit.New(0, 1, clock.New())
+	waitlist := app.NewWaitlist(bot, repo, slog.Default(), app.WithUserRateLimit(limiter))
+
+	t.Run("it drops messages over the limit", func(t *testing.T) {
+		for range 2 {
+			if err := waitlist.Run(t.Context()); err != nil {
+				t.Fatalf("failed to run waitlist logic %s", err)
+			}
+		}
+
+		all, err := repo.GetAllEntries(t.Context())
+		if err != nil {
+			t.Fatalf("failed to get all entries %s", err)
+		}
+
+		if len(all) != 1 {
+			t.Errorf("Expected 1 entry, got %d", len(all))
+		}
+	})
+}
+
+func TestWaitlistFlagsMessages(t *testing.T) {
+	svr := makeServerMock(t, "test_waitlist")
+	repo := repository.New(newDb(t))
+	bot, err := telegram.NewBot(t.Context(), "Token:1234", svr.URL, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = repo.CreateBlockedUser(t.Context(), repository.CreateBlockedUserParams{
+		UserID:    12345,
+		Reason:    "spam",
+		BlockedBy: 11,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitlist := app.NewWaitlist(bot, repo, slog.Default())
+
+	t.Run("it saves flagged messages of blocked users", func(t *testing.T) {
+		if err := waitlist.Run(t.Context()); err != nil {
+			t.Fatalf("failed to run waitlist logic %s", err)
+		}
+
+		entries, err := repo.GetAllEntries(t.Context())
+		if err != nil {
+			t.Fatalf("failed to get all entries %s", err)
+		}
+
+		if len(entries) != 1 {
+			t.Fatalf("expected single entry but got %d", len(entries))
+		}
+
+		if !entries[0].Flagged || entries[0].FlagReason != "user is blocked" {
+			t.Errorf("Unexpected entry %v", entries[0])
+		}
+	})
+}
+
+func TestWaitlistCommitsOffset(t *testing.T) {
+	queries := make(chan string, 2)
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botToken:1234/getMe":
+			io.WriteString(w, `{"ok": true, "result":{"username":"waitlist_bot"}}`)
+		case "/botToken:1234/getUpdates":
+			queries <- r.URL.RawQuery
+			// updates without a message are skipped, so the database is not needed
+			io.WriteString(w, `{"ok": true, "result":[{"update_id": 424416092}]}`)
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(svr.Close)
+
+	bot, err := telegram.NewBot(t.Context(), "Token:1234", svr.URL, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	waitlist := app.NewWaitlist(bot, nil, slog.Default())
+
+	t.Run("it does not commit before the first poll", func(t *testing.T) {
+		if err := waitlist.Commit(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(queries) > 0 {
+			t.Errorf("unexpected poll %s", <-queries)
+		}
+	})
+
+	t.Run("it confirms handled updates", func(t *testing.T) {
+		if err := waitlist.Run(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+		<-queries
+
+		if err := waitlist.Commit(t.Context()); err != nil {
+			t.Fatal(err)
+		}
+
+		if query := <-queries; query != "offset=424416093&timeout=0" {
+			t.Errorf("unexpected commit %s", query)
+		}
+	})
+}
+
+func TestWaitlistResumesAfterFailedUpdate(t *testing.T) {
+	svr := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/botToken:1234/getMe":
+			io.WriteString(w, `{"ok": true, "result":{"username":"waitlist_bot"}}`)
+		case "/botToken:1234/getUpdates":
+			// confirmed updates are not delivered again
+			switch r.URL.Query().Get("offset") {
+			case "0":
+				io.WriteString(w, `{"ok": true, "result":[
+					{"update_id": 1, "message": {"message_id": 1, "from": {"id": 11}, "chat": {"id": 11}, "text": "first"}},
+					{"update_id": 2, "message": {"message_id": 2, "from": {"id": 12}, "chat": {"id": 12}, "text": "second"}}
+				]}`)
+			default:
+				io.WriteString(w, `{"ok": true, "result":[]}`)
+			}
+		default:
+			t.Errorf("unexpected request %s", r.URL.Path)
+		}
+	}))
+	t.Cleanup(svr.Close)
+
+	bot, err := telegram.NewBot(t.Context(), "Token:1234", svr.URL, slog.Default())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := &failingRepo{failOn: 2}
+	waitlist := app.NewWaitlist(bot, repo, slog.Default(), app.WithFilters(filter.Chain{}))
+
+	if err := waitlist.Run(t.Context()); !errors.Is(err, errCreateEntry) {
+		t.Fatalf("expected the second update to fail, got %v", err)
+	}
+
+	if err := waitlist.Run(t.Context()); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(repo.entries) != 1 || repo.entries[0] != "first" {
+		t.Errorf("expected the first entry to be saved once, got %v", repo.entries)
+	}
+}
+
+var errCreateEntry = errors.New("failed to create entry")
+
+// failingRepo fails to save the `failOn`-th entry
+type failingRepo struct {
+	app.Repo
+	failOn  int
+	calls   int
+	entries []string
+}
+
+func (r *failingRepo) UpsertUser(ctx context.Context, arg repository.UpsertUserParams) (repository.User, error) {
+	return repository.User{UserID: arg.UserID}, nil
+}
+
+func (r *failingRepo) CreateEntry(ctx context.Context, arg repository.CreateEntryParams) (sql.Result, error) {
+	if r.calls++; r.calls == r.failOn {
+		return nil, errCreateEntry
+	}
+	r.entries = append(r.entries, arg.Message)
+	return nil, nil
+}
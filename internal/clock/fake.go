@@ -0,0 +1,37 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// NewFake returns a clock standing still at `t` until it is moved with `Set` or `Add`
+func NewFake(t time.Time) *Fake {
+	return &Fake{now: t}
+}
+
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.now
+}
+
+// Set moves the clock to `t`
+func (f *Fake) Set(t time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = t
+}
+
+// Add moves the clock by `d` and returns the new time
+func (f *Fake) Add(d time.Duration) time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.now = f.now.Add(d)
+	return f.now
+}
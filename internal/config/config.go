@@ -0,0 +1,763 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/netip"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+	"github.com/ailinykh/waitlist/internal/logging"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	minSecretLength       = 32
+	minMetricsTokenLength = 16
+)
+
+// Modes pick what the process runs, so the API and the bots can be deployed separately
+const (
+	ModeAll  = "all"
+	ModeAPI  = "api"
+	ModeBots = "bots"
+)
+
+var botTokenRegexp = regexp.MustCompile(`^\d+:[\w-]{30,}$`)
+
+// Config is loaded from the defaults, a YAML or TOML file, environment variables and command line flags,
+// every source overrides the previous one
+type Config struct {
+	// File is never read from the file itself, see `CONFIG_FILE` and `-config`
+	File string `yaml:"-" toml:"-"`
+
+	Mode            string        `yaml:"mode" toml:"mode"`
+	ShutdownTimeout time.Duration `yaml:"shutdown_timeout" toml:"shutdown_timeout"`
+	Port            int           `yaml:"port" toml:"port"`
+	// MonitoringPort serves health checks and metrics when the bots run without the API
+	MonitoringPort int    `yaml:"monitoring_port" toml:"monitoring_port"`
+	StaticFilesDir string `yaml:"static_files_dir" toml:"static_files_dir"`
+	LogLevel       string `yaml:"log_level" toml:"log_level"`
+	LogFormat      string `yaml:"log_format" toml:"log_format"`
+
+	ReadTimeout  time.Duration `yaml:"read_timeout" toml:"read_timeout"`
+	WriteTimeout time.Duration `yaml:"write_timeout" toml:"write_timeout"`
+	IdleTimeout  time.Duration `yaml:"idle_timeout" toml:"idle_timeout"`
+
+	TLSCertFile      string   `yaml:"tls_cert_file" toml:"tls_cert_file"`
+	TLSKeyFile       string   `yaml:"tls_key_file" toml:"tls_key_file"`
+	AutocertDomains  []string `yaml:"autocert_domains" toml:"autocert_domains"`
+	AutocertCacheDir string   `yaml:"autocert_cache_dir" toml:"autocert_cache_dir"`
+	AutocertEmail    string   `yaml:"autocert_email" toml:"autocert_email"`
+	HTTPRedirectPort int      `yaml:"http_redirect_port" toml:"http_redirect_port"`
+
+	DatabaseURL              string        `yaml:"database_url" toml:"database_url"`
+	DatabaseMaxOpenConns     int           `yaml:"database_max_open_conns" toml:"database_max_open_conns"`
+	DatabaseMaxIdleConns     int           `yaml:"database_max_idle_conns" toml:"database_max_idle_conns"`
+	DatabaseConnMaxLifetime  time.Duration `yaml:"database_conn_max_lifetime" toml:"database_conn_max_lifetime"`
+	DatabaseStatementTimeout time.Duration `yaml:"database_statement_timeout" toml:"database_statement_timeout"`
+	DatabaseConnectTimeout   time.Duration `yaml:"database_connect_timeout" toml:"database_connect_timeout"`
+	AutoMigrate              bool          `yaml:"auto_migrate" toml:"auto_migrate"`
+
+	TelegramBotToken   string        `yaml:"telegram_bot_token" toml:"telegram_bot_token"`
+	BotTokens          []string      `yaml:"bot_tokens" toml:"bot_tokens"`
+	TelegramAuthMaxAge time.Duration `yaml:"telegram_auth_max_age" toml:"telegram_auth_max_age"`
+	BotPollMaxAge      time.Duration `yaml:"bot_poll_max_age" toml:"bot_poll_max_age"`
+	AdminTelegramIDs   []int64       `yaml:"admin_telegram_ids" toml:"admin_telegram_ids"`
+
+	LoginAnyBot     bool              `yaml:"login_any_bot" toml:"login_any_bot"`
+	LoginBotDomains map[string]string `yaml:"login_bot_domains" toml:"login_bot_domains"`
+
+	JwtSecret           string   `yaml:"jwt_secret" toml:"jwt_secret"`
+	JwtSigningKey       string   `yaml:"jwt_signing_key" toml:"jwt_signing_key"`
+	JwtPreviousSecrets  []string `yaml:"jwt_previous_secrets" toml:"jwt_previous_secrets"`
+	JwtVerificationKeys []string `yaml:"jwt_verification_keys" toml:"jwt_verification_keys"`
+
+	TrustedProxies []string `yaml:"trusted_proxies" toml:"trusted_proxies"`
+	MetricsToken   string   `yaml:"metrics_token" toml:"metrics_token"`
+	// RateLimit is per user or client IP and per replica, requests per second
+	RateLimit      float64 `yaml:"rate_limit" toml:"rate_limit"`
+	RateLimitBurst int     `yaml:"rate_limit_burst" toml:"rate_limit_burst"`
+	// BotRateLimit is per Telegram user and per bot process, messages saved per second
+	BotRateLimit      float64 `yaml:"bot_rate_limit" toml:"bot_rate_limit"`
+	BotRateLimitBurst int     `yaml:"bot_rate_limit_burst" toml:"bot_rate_limit_burst"`
+
+	// ContentSecurityPolicy replaces the built-in policy allowing the Telegram Login Widget
+	ContentSecurityPolicy string        `yaml:"content_security_policy" toml:"content_security_policy"`
+	HSTSMaxAge            time.Duration `yaml:"hsts_max_age" toml:"hsts_max_age"`
+	FrameOptions          string        `yaml:"frame_options" toml:"frame_options"`
+	ReferrerPolicy        string        `yaml:"referrer_policy" toml:"referrer_policy"`
+
+	CORSAllowedOrigins   []string      `yaml:"cors_allowed_origins" toml:"cors_allowed_origins"`
+	CORSAllowCredentials bool          `yaml:"cors_allow_credentials" toml:"cors_allow_credentials"`
+	CORSMaxAge           time.Duration `yaml:"cors_max_age" toml:"cors_max_age"`
+
+	args []string
+}
+
+func Default() *Config {
+	return &Config{
+		Mode:               ModeAll,
+		ShutdownTimeout:    time.Second * 30,
+		Port:               8080,
+		MonitoringPort:     9090,
+		LogLevel:           "info",
+		LogFormat:          "text",
+		ReadTimeout:        time.Second * 15,
+		WriteTimeout:       time.Second * 30,
+		IdleTimeout:        time.Minute * 2,
+		AutocertCacheDir:   "certs",
+		HSTSMaxAge:         time.Hour * 24 * 365,
+		FrameOptions:       "DENY",
+		ReferrerPolicy:     "strict-origin-when-cross-origin",
+		CORSMaxAge:         time.Hour,
+		RateLimit:          10,
+		RateLimitBurst:     30,
+		BotRateLimit:       0.1,
+		BotRateLimitBurst:  5,
+		TelegramAuthMaxAge: time.Minute * 10,
+		BotPollMaxAge:      time.Minute * 5,
+
+		DatabaseMaxOpenConns:     10,
+		DatabaseMaxIdleConns:     10,
+		DatabaseConnMaxLifetime:  time.Minute * 3,
+		DatabaseStatementTimeout: time.Second * 30,
+		DatabaseConnectTimeout:   time.Second * 30,
+		AutoMigrate:              true,
+	}
+}
+
+// Load reads the config for the command line `args` and `environ` in `os.Environ` format,
+// `validate` picks the settings required, e.g. `Config.Validate`. All the problems found are reported at once.
+// Commands may bind their own `flags`, flags are allowed after positional arguments.
+func Load(args []string, environ []string, validate func(*Config) error, flags ...func(*flag.FlagSet)) (*Config, error) {
+	env := map[string]string{}
+	for _, e := range environ {
+		if key, value, ok := strings.Cut(e, "="); ok {
+			env[key] = value
+		}
+	}
+
+	// flags are parsed twice, the first time only to find the config file
+	probe := Default()
+	fs := probe.flagSet(io.Discard, flags)
+	_, _ = parse(fs, args)
+
+	c := Default()
+	c.File = probe.File
+	if len(c.File) == 0 {
+		c.File = env["CONFIG_FILE"]
+	}
+
+	if len(c.File) > 0 {
+		if err := c.readFile(c.File); err != nil {
+			return nil, err
+		}
+	}
+
+	errs := c.readEnv(env)
+
+	fs = c.flagSet(os.Stderr, flags)
+	positional, err := parse(fs, args)
+	if errors.Is(err, flag.ErrHelp) {
+		return nil, err
+	}
+	if err != nil {
+		errs = append(errs, err)
+	}
+	c.args = positional
+
+	if err := validate(c); err != nil {
+		errs = append(errs, err)
+	}
+
+	if err := errors.Join(errs...); err != nil {
+		return nil, fmt.Errorf("invalid config:\n%w", err)
+	}
+	return c, nil
+}
+
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yml", ".yaml":
+		err = yaml.Unmarshal(data, c)
+	case ".toml":
+		err = toml.Unmarshal(data, c)
+	default:
+		return fmt.Errorf("unsupported config file %s, expected .yml, .yaml or .toml", path)
+	}
+
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %w", path, err)
+	}
+	return nil
+}
+
+func (c *Config) readEnv(env map[string]string) []error {
+	var errs []error
+	lookup := func(key string, parse func(string) error) {
+		if value, ok := env[key]; ok && len(value) > 0 {
+			if err := parse(value); err != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, err))
+			}
+		}
+	}
+
+	lookup("MODE", parseString(&c.Mode))
+	lookup("SHUTDOWN_TIMEOUT", parseDuration(&c.ShutdownTimeout))
+	lookup("PORT", parseInt(&c.Port))
+	lookup("STATIC_FILES_DIR", parseString(&c.StaticFilesDir))
+	lookup("DATABASE_URL", parseString(&c.DatabaseURL))
+	lookup("DATABASE_MAX_OPEN_CONNS", parseInt(&c.DatabaseMaxOpenConns))
+	lookup("DATABASE_MAX_IDLE_CONNS", parseInt(&c.DatabaseMaxIdleConns))
+	lookup("DATABASE_CONN_MAX_LIFETIME", parseDuration(&c.DatabaseConnMaxLifetime))
+	lookup("DATABASE_STATEMENT_TIMEOUT", parseDuration(&c.DatabaseStatementTimeout))
+	lookup("DATABASE_CONNECT_TIMEOUT", parseDuration(&c.DatabaseConnectTimeout))
+	lookup("AUTO_MIGRATE", parseBool(&c.AutoMigrate))
+	lookup("LOG_LEVEL", parseString(&c.LogLevel))
+	lookup("LOG_FORMAT", parseString(&c.LogFormat))
+	lookup("READ_TIMEOUT", parseDuration(&c.ReadTimeout))
+	lookup("WRITE_TIMEOUT", parseDuration(&c.WriteTimeout))
+	lookup("IDLE_TIMEOUT", parseDuration(&c.IdleTimeout))
+	lookup("TLS_CERT_FILE", parseString(&c.TLSCertFile))
+	lookup("TLS_KEY_FILE", parseString(&c.TLSKeyFile))
+	lookup("AUTOCERT_DOMAINS", parseList(&c.AutocertDomains))
+	lookup("AUTOCERT_CACHE_DIR", parseString(&c.AutocertCacheDir))
+	lookup("AUTOCERT_EMAIL", parseString(&c.AutocertEmail))
+	lookup("HTTP_REDIRECT_PORT", parseInt(&c.HTTPRedirectPort))
+	lookup("MONITORING_PORT", parseInt(&c.MonitoringPort))
+	lookup("TELEGRAM_BOT_TOKEN", parseString(&c.TelegramBotToken))
+	lookup("TELEGRAM_AUTH_MAX_AGE", parseDuration(&c.TelegramAuthMaxAge))
+	lookup("BOT_POLL_MAX_AGE", parseDuration(&c.BotPollMaxAge))
+	lookup("ADMIN_TELEGRAM_IDS", parseIDs(&c.AdminTelegramIDs))
+	lookup("LOGIN_ANY_BOT", parseBool(&c.LoginAnyBot))
+	lookup("LOGIN_BOT_DOMAINS", parseMap(&c.LoginBotDomains))
+	lookup("JWT_SECRET", parseString(&c.JwtSecret))
+	lookup("JWT_SIGNING_KEY", parseString(&c.JwtSigningKey))
+	lookup("JWT_PREVIOUS_SECRETS", parseList(&c.JwtPreviousSecrets))
+	lookup("JWT_VERIFICATION_KEYS", parseList(&c.JwtVerificationKeys))
+	lookup("TRUSTED_PROXIES", parseList(&c.TrustedProxies))
+	lookup("METRICS_TOKEN", parseString(&c.MetricsToken))
+	lookup("RATE_LIMIT", parseFloat(&c.RateLimit))
+	lookup("RATE_LIMIT_BURST", parseInt(&c.RateLimitBurst))
+	lookup("BOT_RATE_LIMIT", parseFloat(&c.BotRateLimit))
+	lookup("BOT_RATE_LIMIT_BURST", parseInt(&c.BotRateLimitBurst))
+	lookup("CONTENT_SECURITY_POLICY", parseString(&c.ContentSecurityPolicy))
+	lookup("HSTS_MAX_AGE", parseDuration(&c.HSTSMaxAge))
+	lookup("FRAME_OPTIONS", parseString(&c.FrameOptions))
+	lookup("REFERRER_POLICY", parseString(&c.ReferrerPolicy))
+	lookup("CORS_ALLOWED_ORIGINS", parseList(&c.CORSAllowedOrigins))
+	lookup("CORS_ALLOW_CREDENTIALS", parseBool(&c.CORSAllowCredentials))
+	lookup("CORS_MAX_AGE", parseDuration(&c.CORSMaxAge))
+
+	// every other `TELEGRAM_BOT_TOKEN*` variable adds a bot, e.g. `TELEGRAM_BOT_TOKEN_SUPPORT`
+	keys := []string{}
+	for key, value := range env {
+		if strings.HasPrefix(key, "TELEGRAM_BOT_TOKEN") && key != "TELEGRAM_BOT_TOKEN" && len(value) > 0 {
+			keys = append(keys, key)
+		}
+	}
+	if len(keys) > 0 {
+		slices.Sort(keys)
+		c.BotTokens = []string{}
+		for _, key := range keys {
+			c.BotTokens = append(c.BotTokens, env[key])
+		}
+	}
+	return errs
+}
+
+// parse collects positional arguments in between the flags, e.g. `users promote 42 -role admin`
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	positional := []string{}
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, nil
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// flagSet binds flags to the config, values loaded so far become the defaults.
+// Secrets are never shown in the usage.
+func (c *Config) flagSet(output io.Writer, flags []func(*flag.FlagSet)) *flag.FlagSet {
+	fs := flag.NewFlagSet("waitlist", flag.ContinueOnError)
+	fs.SetOutput(output)
+
+	fs.StringVar(&c.File, "config", c.File, "YAML or TOML config `file`")
+	fs.StringVar(&c.Mode, "mode", c.Mode, "run all, only the api or only the bots")
+	fs.DurationVar(&c.ShutdownTimeout, "shutdown-timeout", c.ShutdownTimeout, "how long to wait for requests and updates in progress on shutdown")
+	fs.IntVar(&c.Port, "port", c.Port, "HTTP server port")
+	fs.StringVar(&c.StaticFilesDir, "static-files-dir", c.StaticFilesDir, "SPA build `dir`, overrides the build embedded with -tags embedweb")
+	fs.DurationVar(&c.ReadTimeout, "read-timeout", c.ReadTimeout, "how long to read a request, 0 disables the limit")
+	fs.DurationVar(&c.WriteTimeout, "write-timeout", c.WriteTimeout, "how long to write a response, 0 disables the limit")
+	fs.DurationVar(&c.IdleTimeout, "idle-timeout", c.IdleTimeout, "how long to keep idle connections, 0 disables the limit")
+	fs.StringVar(&c.TLSCertFile, "tls-cert-file", c.TLSCertFile, "PEM certificate `file` to serve HTTPS")
+	fs.StringVar(&c.TLSKeyFile, "tls-key-file", c.TLSKeyFile, "PEM private key `file` of the certificate")
+	fs.Func("autocert-domains", "comma separated `domains` to get Let's Encrypt certificates for", parseList(&c.AutocertDomains))
+	fs.StringVar(&c.AutocertCacheDir, "autocert-cache-dir", c.AutocertCacheDir, "`dir` keeping Let's Encrypt certificates across restarts")
+	fs.StringVar(&c.AutocertEmail, "autocert-email", c.AutocertEmail, "contact `email` for Let's Encrypt expiry notices")
+	fs.IntVar(&c.HTTPRedirectPort, "http-redirect-port", c.HTTPRedirectPort, "plain HTTP port redirecting to HTTPS, 0 disables the listener")
+	fs.IntVar(&c.MonitoringPort, "monitoring-port", c.MonitoringPort, "port serving /healthz, /readyz and /metrics in bots mode, 0 disables the listener")
+	fs.Func("database-url", "Postgres connection `url`", parseString(&c.DatabaseURL))
+	fs.IntVar(&c.DatabaseMaxOpenConns, "database-max-open-conns", c.DatabaseMaxOpenConns, "connection pool size")
+	fs.IntVar(&c.DatabaseMaxIdleConns, "database-max-idle-conns", c.DatabaseMaxIdleConns, "idle connections kept in the pool")
+	fs.DurationVar(&c.DatabaseConnMaxLifetime, "database-conn-max-lifetime", c.DatabaseConnMaxLifetime, "connections are recycled after this long")
+	fs.DurationVar(&c.DatabaseStatementTimeout, "database-statement-timeout", c.DatabaseStatementTimeout, "queries running longer are aborted, 0 disables the limit")
+	fs.DurationVar(&c.DatabaseConnectTimeout, "database-connect-timeout", c.DatabaseConnectTimeout, "how long to wait for the database on startup")
+	fs.BoolVar(&c.AutoMigrate, "auto-migrate", c.AutoMigrate, "apply migrations on startup, see `migrate` command otherwise")
+	fs.StringVar(&c.LogLevel, "log-level", c.LogLevel, "debug, info, warn or error")
+	fs.StringVar(&c.LogFormat, "log-format", c.LogFormat, "text or json")
+	fs.Func("telegram-bot-token", "login bot `token`, the bot also collects the waitlist", parseString(&c.TelegramBotToken))
+	fs.Func("bot-tokens", "comma separated `tokens` of other waitlist bots", parseList(&c.BotTokens))
+	fs.DurationVar(&c.TelegramAuthMaxAge, "telegram-auth-max-age", c.TelegramAuthMaxAge, "how long Telegram login payload stays valid")
+	fs.DurationVar(&c.BotPollMaxAge, "bot-poll-max-age", c.BotPollMaxAge, "bots not polled successfully for this long are not ready")
+	fs.Func("admin-telegram-ids", "comma separated Telegram user `ids` promoted to admin on first login", parseIDs(&c.AdminTelegramIDs))
+	fs.BoolVar(&c.LoginAnyBot, "login-any-bot", c.LoginAnyBot, "let users log in through any of the bots, not only the telegram-bot-token one")
+	fs.Func("login-bot-domains", "comma separated `host=bot` pairs picking the login bot by domain", parseMap(&c.LoginBotDomains))
+	fs.Func("jwt-secret", "HMAC `secret` for signing tokens", parseString(&c.JwtSecret))
+	fs.StringVar(&c.JwtSigningKey, "jwt-signing-key", c.JwtSigningKey, "PEM `file` with Ed25519 or RSA private key for signing tokens")
+	fs.Func("jwt-previous-secrets", "comma separated HMAC `secrets` still valid for verification", parseList(&c.JwtPreviousSecrets))
+	fs.Func("jwt-verification-keys", "comma separated PEM `files` still valid for verification", parseList(&c.JwtVerificationKeys))
+	fs.Func("trusted-proxies", "comma separated `CIDRs` allowed to pass X-Forwarded-For", parseList(&c.TrustedProxies))
+	fs.Func("metrics-token", "bearer `token` for /metrics, the endpoint is disabled without it", parseString(&c.MetricsToken))
+	fs.Float64Var(&c.RateLimit, "rate-limit", c.RateLimit, "API requests per second allowed per user or client IP")
+	fs.IntVar(&c.RateLimitBurst, "rate-limit-burst", c.RateLimitBurst, "API requests allowed at once per user or client IP")
+	fs.Float64Var(&c.BotRateLimit, "bot-rate-limit", c.BotRateLimit, "messages per second saved per Telegram user, the rest are dropped")
+	fs.IntVar(&c.BotRateLimitBurst, "bot-rate-limit-burst", c.BotRateLimitBurst, "messages saved at once per Telegram user")
+	fs.StringVar(&c.ContentSecurityPolicy, "content-security-policy", c.ContentSecurityPolicy, "Content-Security-Policy `header`, the built-in one allows the Telegram Login Widget")
+	fs.DurationVar(&c.HSTSMaxAge, "hsts-max-age", c.HSTSMaxAge, "Strict-Transport-Security max age, 0 disables the header")
+	fs.StringVar(&c.FrameOptions, "frame-options", c.FrameOptions, "X-Frame-Options header, empty disables it")
+	fs.StringVar(&c.ReferrerPolicy, "referrer-policy", c.ReferrerPolicy, "Referrer-Policy header, empty disables it")
+	fs.Func("cors-allowed-origins", "comma separated `origins` allowed to call the API, * allows any", parseList(&c.CORSAllowedOrigins))
+	fs.BoolVar(&c.CORSAllowCredentials, "cors-allow-credentials", c.CORSAllowCredentials, "let allowed origins send the session cookies")
+	fs.DurationVar(&c.CORSMaxAge, "cors-max-age", c.CORSMaxAge, "how long browsers cache preflight responses")
+
+	for _, bind := range flags {
+		bind(fs)
+	}
+	return fs
+}
+
+// Validate reports every problem of the config at once, only the settings used in the `Mode` are required
+func (c *Config) Validate() error {
+	errs := []error{c.ValidateDatabase(), c.ValidateBots()}
+	switch c.Mode {
+	case ModeAll, ModeAPI:
+		errs = append(errs, c.ValidateJwt(), c.validateServer())
+	case ModeBots:
+		errs = append(errs, c.validateMonitoring())
+	default:
+		errs = append(errs, fmt.Errorf("mode must be one of %s, %s or %s, got %q", ModeAll, ModeAPI, ModeBots, c.Mode))
+	}
+
+	if c.ShutdownTimeout <= 0 {
+		errs = append(errs, errors.New("shutdown_timeout must be positive"))
+	}
+	return errors.Join(errs...)
+}
+
+// validateMonitoring checks the listener the bots are observed through when the API is not served
+func (c *Config) validateMonitoring() error {
+	var errs []error
+	if c.MonitoringPort < 0 || c.MonitoringPort > 65535 {
+		errs = append(errs, fmt.Errorf("monitoring_port must be between 1 and 65535 or 0, got %d", c.MonitoringPort))
+	}
+
+	if len(c.MetricsToken) > 0 && len(c.MetricsToken) < minMetricsTokenLength {
+		errs = append(errs, fmt.Errorf("metrics_token must be at least %d characters", minMetricsTokenLength))
+	}
+	return errors.Join(errs...)
+}
+
+func (c *Config) validateServer() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if c.Port < 1 || c.Port > 65535 {
+		fail("port must be between 1 and 65535, got %d", c.Port)
+	}
+
+	if c.TelegramAuthMaxAge <= 0 {
+		fail("telegram_auth_max_age must be positive")
+	}
+
+	if c.ReadTimeout < 0 || c.WriteTimeout < 0 || c.IdleTimeout < 0 {
+		fail("read_timeout, write_timeout and idle_timeout must not be negative")
+	}
+
+	if (len(c.TLSCertFile) > 0) != (len(c.TLSKeyFile) > 0) {
+		fail("tls_cert_file and tls_key_file must be set together")
+	}
+
+	if len(c.TLSCertFile) > 0 && len(c.AutocertDomains) > 0 {
+		fail("tls_cert_file and autocert_domains are mutually exclusive")
+	}
+
+	if len(c.AutocertDomains) > 0 && len(c.AutocertCacheDir) == 0 {
+		fail("autocert_cache_dir is required for autocert_domains")
+	}
+
+	if c.HTTPRedirectPort != 0 {
+		if c.HTTPRedirectPort < 1 || c.HTTPRedirectPort > 65535 || c.HTTPRedirectPort == c.Port {
+			fail("http_redirect_port must be between 1 and 65535 and differ from port, got %d", c.HTTPRedirectPort)
+		}
+		if !c.TLS() {
+			fail("http_redirect_port requires tls_cert_file or autocert_domains")
+		}
+	}
+
+	for host, bot := range c.LoginBotDomains {
+		if len(host) == 0 || len(bot) == 0 {
+			fail("login_bot_domains: expected host=bot, got %q=%q", host, bot)
+		}
+	}
+
+	if len(c.MetricsToken) > 0 && len(c.MetricsToken) < minMetricsTokenLength {
+		fail("metrics_token must be at least %d characters", minMetricsTokenLength)
+	}
+
+	for _, s := range c.TrustedProxies {
+		if _, err := parsePrefix(s); err != nil {
+			fail("trusted_proxies: %w", err)
+		}
+	}
+
+	if c.RateLimit <= 0 || c.RateLimitBurst < 1 {
+		fail("rate_limit and rate_limit_burst must be positive")
+	}
+
+	if c.HSTSMaxAge < 0 || c.CORSMaxAge < 0 {
+		fail("hsts_max_age and cors_max_age must not be negative")
+	}
+
+	for _, origin := range c.CORSAllowedOrigins {
+		if origin == "*" {
+			if c.CORSAllowCredentials {
+				fail("cors_allowed_origins: * is not allowed along with cors_allow_credentials")
+			}
+			continue
+		}
+		// browsers send the origin as scheme://host[:port]
+		if u, err := url.Parse(origin); err != nil || len(u.Scheme) == 0 || len(u.Host) == 0 || len(u.Path) > 0 {
+			fail("cors_allowed_origins: expected scheme://host[:port], got %q", origin)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateBots checks what polling the bots needs, e.g. `bots run` command
+func (c *Config) ValidateBots() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(c.TelegramBotToken) == 0 {
+		fail("telegram_bot_token is required")
+	} else if !botTokenRegexp.MatchString(c.TelegramBotToken) {
+		fail("telegram_bot_token is malformed")
+	}
+
+	for i, token := range c.BotTokens {
+		if !botTokenRegexp.MatchString(token) {
+			fail("bot_tokens[%d] is malformed", i)
+		}
+	}
+
+	if c.BotPollMaxAge <= 0 {
+		fail("bot_poll_max_age must be positive")
+	}
+
+	if c.BotRateLimit <= 0 || c.BotRateLimitBurst < 1 {
+		fail("bot_rate_limit and bot_rate_limit_burst must be positive")
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateJwt checks what signing tokens needs, e.g. `token issue` command
+func (c *Config) ValidateJwt() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(c.JwtSecret) == 0 && len(c.JwtSigningKey) == 0 {
+		fail("jwt_secret or jwt_signing_key is required")
+	}
+
+	if len(c.JwtSecret) > 0 && len(c.JwtSecret) < minSecretLength {
+		fail("jwt_secret must be at least %d characters", minSecretLength)
+	}
+
+	for i, secret := range c.JwtPreviousSecrets {
+		if len(secret) < minSecretLength {
+			fail("jwt_previous_secrets[%d] must be at least %d characters", i, minSecretLength)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// ValidateDatabase only checks what commands working with the database alone need, e.g. `migrate`
+func (c *Config) ValidateDatabase() error {
+	var errs []error
+	fail := func(format string, args ...any) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(c.DatabaseURL) == 0 {
+		fail("database_url is required")
+	}
+
+	if c.DatabaseMaxOpenConns < 1 {
+		fail("database_max_open_conns must be positive")
+	}
+
+	if c.DatabaseMaxIdleConns < 0 {
+		fail("database_max_idle_conns must not be negative")
+	}
+
+	if c.DatabaseConnMaxLifetime < 0 || c.DatabaseStatementTimeout < 0 {
+		fail("database_conn_max_lifetime and database_statement_timeout must not be negative")
+	}
+
+	if c.DatabaseConnectTimeout <= 0 {
+		fail("database_connect_timeout must be positive")
+	}
+
+	if err := new(slog.Level).UnmarshalText([]byte(c.LogLevel)); err != nil {
+		fail("log_level must be one of debug, info, warn or error, got %q", c.LogLevel)
+	}
+
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		fail("log_format must be text or json, got %q", c.LogFormat)
+	}
+
+	return errors.Join(errs...)
+}
+
+// Args returns positional command line arguments left after the flags
+func (c *Config) Args() []string {
+	return c.args
+}
+
+func (c *Config) Level() slog.Level {
+	var level slog.Level
+	_ = level.UnmarshalText([]byte(c.LogLevel))
+	return level
+}
+
+// TLS reports whether the server serves HTTPS, either with the certificate files or autocert
+func (c *Config) TLS() bool {
+	return len(c.TLSCertFile) > 0 || len(c.AutocertDomains) > 0
+}
+
+// Bots returns tokens of every bot collecting the waitlist, the login bot included
+func (c *Config) Bots() []string {
+	tokens := []string{}
+	for _, token := range append([]string{c.TelegramBotToken}, c.BotTokens...) {
+		if len(token) > 0 && !slices.Contains(tokens, token) {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens
+}
+
+// Proxies parses `TrustedProxies`, addresses are treated as single host prefixes
+func (c *Config) Proxies() []netip.Prefix {
+	prefixes := []netip.Prefix{}
+	for _, s := range c.TrustedProxies {
+		if prefix, err := parsePrefix(s); err == nil {
+			prefixes = append(prefixes, prefix)
+		}
+	}
+	return prefixes
+}
+
+func (c Config) LogValue() slog.Value {
+	databaseURL := logging.Mask(c.DatabaseURL)
+	if u, err := url.Parse(c.DatabaseURL); err == nil {
+		databaseURL = u.Redacted()
+	}
+	return slog.GroupValue(
+		slog.String("file", c.File),
+		slog.String("mode", c.Mode),
+		slog.Duration("shutdownTimeout", c.ShutdownTimeout),
+		slog.Int("port", c.Port),
+		slog.String("staticFilesDir", c.StaticFilesDir),
+		slog.Duration("readTimeout", c.ReadTimeout),
+		slog.Duration("writeTimeout", c.WriteTimeout),
+		slog.Duration("idleTimeout", c.IdleTimeout),
+		slog.String("tlsCertFile", c.TLSCertFile),
+		slog.String("tlsKeyFile", c.TLSKeyFile),
+		slog.Any("autocertDomains", c.AutocertDomains),
+		slog.String("autocertCacheDir", c.AutocertCacheDir),
+		slog.String("autocertEmail", c.AutocertEmail),
+		slog.Int("httpRedirectPort", c.HTTPRedirectPort),
+		slog.Int("monitoringPort", c.MonitoringPort),
+		slog.String("databaseURL", databaseURL),
+		slog.Int("databaseMaxOpenConns", c.DatabaseMaxOpenConns),
+		slog.Int("databaseMaxIdleConns", c.DatabaseMaxIdleConns),
+		slog.Duration("databaseConnMaxLifetime", c.DatabaseConnMaxLifetime),
+		slog.Duration("databaseStatementTimeout", c.DatabaseStatementTimeout),
+		slog.Duration("databaseConnectTimeout", c.DatabaseConnectTimeout),
+		slog.Bool("autoMigrate", c.AutoMigrate),
+		slog.String("logLevel", c.LogLevel),
+		slog.String("logFormat", c.LogFormat),
+		slog.String("telegramBotToken", logging.Mask(c.TelegramBotToken)),
+		slog.Any("botTokens", logging.MaskAll(c.BotTokens)),
+		slog.Duration("telegramAuthMaxAge", c.TelegramAuthMaxAge),
+		slog.Duration("botPollMaxAge", c.BotPollMaxAge),
+		slog.Any("adminTelegramIDs", c.AdminTelegramIDs),
+		slog.Bool("loginAnyBot", c.LoginAnyBot),
+		slog.Any("loginBotDomains", c.LoginBotDomains),
+		slog.String("jwtSecret", logging.Mask(c.JwtSecret)),
+		slog.String("jwtSigningKey", c.JwtSigningKey),
+		slog.Any("jwtPreviousSecrets", logging.MaskAll(c.JwtPreviousSecrets)),
+		slog.Any("jwtVerificationKeys", c.JwtVerificationKeys),
+		slog.Any("trustedProxies", c.TrustedProxies),
+		slog.String("metricsToken", logging.Mask(c.MetricsToken)),
+		slog.Float64("rateLimit", c.RateLimit),
+		slog.Int("rateLimitBurst", c.RateLimitBurst),
+		slog.Float64("botRateLimit", c.BotRateLimit),
+		slog.Int("botRateLimitBurst", c.BotRateLimitBurst),
+		slog.String("contentSecurityPolicy", c.ContentSecurityPolicy),
+		slog.Duration("hstsMaxAge", c.HSTSMaxAge),
+		slog.String("frameOptions", c.FrameOptions),
+		slog.String("referrerPolicy", c.ReferrerPolicy),
+		slog.Any("corsAllowedOrigins", c.CORSAllowedOrigins),
+		slog.Bool("corsAllowCredentials", c.CORSAllowCredentials),
+		slog.Duration("corsMaxAge", c.CORSMaxAge),
+	)
+}
+
+func parsePrefix(s string) (netip.Prefix, error) {
+	if addr, err := netip.ParseAddr(s); err == nil {
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+	return netip.ParsePrefix(s)
+}
+
+func parseString(p *string) func(string) error {
+	return func(s string) error {
+		*p = s
+		return nil
+	}
+}
+
+func parseInt(p *int) func(string) error {
+	return func(s string) error {
+		v, err := strconv.Atoi(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
+
+func parseFloat(p *float64) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseFloat(s, 64)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
+
+func parseDuration(p *time.Duration) func(string) error {
+	return func(s string) error {
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return err
+		}
+		*p = d
+		return nil
+	}
+}
+
+func parseBool(p *bool) func(string) error {
+	return func(s string) error {
+		v, err := strconv.ParseBool(s)
+		if err != nil {
+			return err
+		}
+		*p = v
+		return nil
+	}
+}
+
+func parseList(p *[]string) func(string) error {
+	return func(s string) error {
+		*p = split(s)
+		return nil
+	}
+}
+
+func parseIDs(p *[]int64) func(string) error {
+	return func(s string) error {
+		ids := []int64{}
+		for _, v := range split(s) {
+			id, err := strconv.ParseInt(v, 10, 64)
+			if err != nil {
+				return err
+			}
+			ids = append(ids, id)
+		}
+		*p = ids
+		return nil
+	}
+}
+
+// parseMap reads `key=value` pairs, e.g. `example.com=waitlist_bot,other.com=other_bot`
+func parseMap(p *map[string]string) func(string) error {
+	return func(s string) error {
+		values := map[string]string{}
+		for _, pair := range split(s) {
+			key, value, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("expected key=value, got %q", pair)
+			}
+			values[strings.TrimSpace(key)] = strings.TrimSpace(value)
+		}
+		*p = values
+		return nil
+	}
+}
+
+func split(s string) []string {
+	values := []string{}
+	for _, v := range strings.Split(s, ",") {
+		if v = strings.TrimSpace(v); len(v) > 0 {
+			values = append(values, v)
+		}
+	}
+	return values
+}
@@ -1,17 +1,20 @@
 package database
 
 import (
+	"context"
 	"database/sql"
 	"errors"
 	"fmt"
 	"io/fs"
 	"log/slog"
-	"os"
+	"maps"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
 	"time"
 
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	"github.com/golang-migrate/migrate/v4/source/iofs"
+	_ "github.com/lib/pq"
 )
 
 func WithURL(url string) func(*Connection) {
@@ -20,17 +23,57 @@ func WithURL(url string) func(*Connection) {
 	}
 }
 
+// WithMigrations applies the migrations on connect, see `Migrator`
 func WithMigrations(migrations fs.FS) func(*Connection) {
 	return func(c *Connection) {
 		c.migrations = migrations
 	}
 }
 
+// WithPool sizes the connection pool, see `sql.DB.SetMaxOpenConns` and friends
+func WithPool(maxOpen, maxIdle int, maxLifetime, maxIdleTime time.Duration) func(*Connection) {
+	return func(c *Connection) {
+		c.maxOpenConns = maxOpen
+		c.maxIdleConns = maxIdle
+		c.connMaxLifetime = maxLifetime
+		c.connMaxIdleTime = maxIdleTime
+	}
+}
+
+// WithStatementTimeout makes Postgres abort queries running longer than `timeout`, zero disables the limit
+func WithStatementTimeout(timeout time.Duration) func(*Connection) {
+	return func(c *Connection) {
+		c.statementTimeout = timeout
+	}
+}
+
+// WithApplicationName tells Postgres who is connected, e.g. in `pg_stat_activity`
+func WithApplicationName(name string) func(*Connection) {
+	return func(c *Connection) {
+		c.applicationName = name
+	}
+}
+
+// WithConnectRetry keeps pinging the database with exponential backoff starting at `backoff`
+// until it responds or `timeout` passes, e.g. while Postgres container is still starting
+func WithConnectRetry(timeout, backoff time.Duration) func(*Connection) {
+	return func(c *Connection) {
+		c.connectTimeout = timeout
+		c.connectBackoff = backoff
+	}
+}
+
 func New(logger *slog.Logger, opts ...func(*Connection)) (*sql.DB, error) {
 	conn := &Connection{
-		url:        os.Getenv("DATABASE_URL"),
-		logger:     logger,
-		migrations: nil,
+		url:             "",
+		logger:          logger,
+		migrations:      nil,
+		maxOpenConns:    10,
+		maxIdleConns:    10,
+		connMaxLifetime: time.Minute * 3,
+		connectTimeout:  time.Second * 30,
+		connectBackoff:  time.Millisecond * 500,
+		migrateTimeout:  time.Minute * 5,
 	}
 
 	for _, opt := range opts {
@@ -41,38 +84,128 @@ func New(logger *slog.Logger, opts ...func(*Connection)) (*sql.DB, error) {
 }
 
 type Connection struct {
-	url        string
-	logger     *slog.Logger
-	migrations fs.FS
+	url              string
+	logger           *slog.Logger
+	migrations       fs.FS
+	maxOpenConns     int
+	maxIdleConns     int
+	connMaxLifetime  time.Duration
+	connMaxIdleTime  time.Duration
+	statementTimeout time.Duration
+	applicationName  string
+	connectTimeout   time.Duration
+	connectBackoff   time.Duration
+	migrateTimeout   time.Duration
 }
 
+const maxConnectBackoff = time.Second * 10
+
 func (conn *Connection) build() (*sql.DB, error) {
-	db, err := sql.Open("postgres", conn.url)
+	if len(conn.url) == 0 {
+		return nil, errors.New("database url is required")
+	}
+
+	params := map[string]string{}
+	if len(conn.applicationName) > 0 {
+		params["application_name"] = conn.applicationName
+	}
+
+	// migrations may legitimately run longer than regular queries, so they are not limited
+	migrationsURL, err := withParams(conn.url, params)
+	if err != nil {
+		return nil, err
+	}
+
+	if conn.statementTimeout > 0 {
+		params["statement_timeout"] = strconv.FormatInt(conn.statementTimeout.Milliseconds(), 10)
+	}
+
+	dsn, err := withParams(conn.url, params)
 	if err != nil {
 		return nil, err
 	}
-	// TODO: move to opts
-	db.SetConnMaxLifetime(time.Minute * 3)
-	db.SetMaxOpenConns(10)
-	db.SetMaxIdleConns(10)
+
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	db.SetConnMaxLifetime(conn.connMaxLifetime)
+	db.SetConnMaxIdleTime(conn.connMaxIdleTime)
+	db.SetMaxOpenConns(conn.maxOpenConns)
+	db.SetMaxIdleConns(conn.maxIdleConns)
+
+	if err := conn.ping(db); err != nil {
+		db.Close()
+		return nil, err
+	}
 
 	if conn.migrations != nil {
 		conn.logger.Debug("running migrations")
 
-		source, err := iofs.New(conn.migrations, "migrations")
-		if err != nil {
-			return nil, fmt.Errorf("failed to create source: %w", err)
+		ctx, cancel := context.WithTimeout(context.Background(), conn.migrateTimeout)
+		defer cancel()
+
+		if err := NewMigrator(migrationsURL, conn.migrations, conn.logger).Up(ctx); err != nil {
+			db.Close()
+			return nil, err
 		}
+	}
+
+	return db, nil
+}
+
+// ping waits for the database to accept connections, retrying with exponential backoff until the deadline
+func (conn *Connection) ping(db *sql.DB) error {
+	ctx, cancel := context.WithTimeout(context.Background(), conn.connectTimeout)
+	defer cancel()
 
-		migrator, err := migrate.NewWithSourceInstance("iofs", source, conn.url)
+	backoff := conn.connectBackoff
+	for attempt := 1; ; attempt++ {
+		err := db.PingContext(ctx)
+		if err == nil {
+			return nil
+		}
+
+		conn.logger.Warn("database is not available", slog.Int("attempt", attempt), slog.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("failed to connect database in %s: %w", conn.connectTimeout, err)
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, maxConnectBackoff)
+	}
+}
+
+// withParams adds connection parameters to either URL or `key=value` connection string,
+// parameters already present in the connection string win
+func withParams(dsn string, params map[string]string) (string, error) {
+	if len(params) == 0 {
+		return dsn, nil
+	}
+
+	keys := slices.Sorted(maps.Keys(params))
+
+	if strings.HasPrefix(dsn, "postgres://") || strings.HasPrefix(dsn, "postgresql://") {
+		u, err := url.Parse(dsn)
 		if err != nil {
-			return nil, fmt.Errorf("failed to create migration source: %w", err)
+			return "", fmt.Errorf("failed to parse database url: %w", err)
 		}
 
-		if err := migrator.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
-			return nil, fmt.Errorf("failed to migrate database: %w", err)
+		query := u.Query()
+		for _, key := range keys {
+			if !query.Has(key) {
+				query.Set(key, params[key])
+			}
 		}
+		u.RawQuery = query.Encode()
+		return u.String(), nil
 	}
 
-	return db, nil
+	for _, key := range keys {
+		if !strings.Contains(dsn, key+"=") {
+			dsn += fmt.Sprintf(" %s='%s'", key, strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(params[key]))
+		}
+	}
+	return dsn, nil
 }
@@ -0,0 +1,202 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"time"
+)
+
+// WithLeaseInterval sets how often the lease is retried while held elsewhere
+// and how often the holder makes sure its session is still alive
+func WithLeaseInterval(interval time.Duration) func(*Lease) {
+	return func(l *Lease) {
+		l.interval = interval
+	}
+}
+
+// WithLeaseStandby calls `fn` every interval while the lease is held by another process,
+// e.g. to report the standby process healthy
+func WithLeaseStandby(fn func()) func(*Lease) {
+	return func(l *Lease) {
+		l.standby = fn
+	}
+}
+
+// WithLeaseRetry makes the lease run `fn` again when it fails instead of returning the error.
+// The lease is released meanwhile, the delay doubles from the lease interval up to `maxBackoff`.
+func WithLeaseRetry(maxBackoff time.Duration) func(*Lease) {
+	return func(l *Lease) {
+		l.maxBackoff = maxBackoff
+	}
+}
+
+// Lease makes sure only one process at a time does the work named `name`, e.g. polls a bot.
+// It is a session level Postgres advisory lock held on a dedicated connection,
+// so the lease is released as soon as the holder exits or loses the connection.
+type Lease struct {
+	db         *sql.DB
+	name       string
+	key        int64
+	interval   time.Duration
+	maxBackoff time.Duration
+	standby    func()
+	logger     *slog.Logger
+}
+
+func NewLease(db *sql.DB, name string, logger *slog.Logger, opts ...func(*Lease)) *Lease {
+	l := &Lease{
+		db:       db,
+		name:     name,
+		key:      leaseKey(name),
+		interval: time.Second * 10,
+		standby:  func() {},
+		logger:   logger,
+	}
+
+	for _, opt := range opts {
+		opt(l)
+	}
+	return l
+}
+
+// Run waits for the lease and calls `fn` holding it. The context passed to `fn` is canceled
+// once the lease is lost, in which case the lease is taken again when possible.
+// Run returns when `ctx` is done or with the error of `fn`, unless failures are retried, see `WithLeaseRetry`.
+func (l *Lease) Run(ctx context.Context, fn func(context.Context) error) error {
+	failures := 0
+	for {
+		conn, err := l.acquire(ctx)
+		if err != nil {
+			return nil // ctx is done
+		}
+
+		l.logger.Info("lease acquired", slog.String("lease", l.name))
+		started := time.Now()
+		err = l.hold(ctx, conn, fn)
+		l.release(conn)
+
+		switch {
+		case errors.Is(err, errLeaseLost):
+			continue
+		case err == nil || ctx.Err() != nil || l.maxBackoff == 0:
+			return err
+		}
+
+		// a holder running longer than the longest delay is not failing repeatedly
+		if time.Since(started) > l.maxBackoff {
+			failures = 0
+		}
+		delay := min(l.interval<<failures, l.maxBackoff)
+		failures++
+		l.logger.Error("lease holder failed", slog.String("lease", l.name), slog.Duration("retry_in", delay), slog.Any("error", err))
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(delay):
+		}
+	}
+}
+
+var errLeaseLost = errors.New("lease lost")
+
+// acquire only fails once `ctx` is done, every other problem is retried
+func (l *Lease) acquire(ctx context.Context) (*sql.Conn, error) {
+	waiting := false
+	for {
+		conn, err := l.tryLock(ctx)
+		switch {
+		case conn != nil:
+			return conn, nil
+		case err != nil && ctx.Err() == nil:
+			l.logger.Warn("failed to acquire lease", slog.String("lease", l.name), slog.Any("error", err))
+		case err == nil:
+			if !waiting {
+				l.logger.Info("lease is held by another process", slog.String("lease", l.name))
+				waiting = true
+			}
+			l.standby()
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(l.interval):
+		}
+	}
+}
+
+// tryLock returns nil connection when the lock is held by another session
+func (l *Lease) tryLock(ctx context.Context) (*sql.Conn, error) {
+	conn, err := l.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var locked bool
+	if err := conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", l.key).Scan(&locked); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to take advisory lock: %w", err)
+	}
+
+	if !locked {
+		conn.Close()
+		return nil, nil
+	}
+	return conn, nil
+}
+
+// hold runs `fn` until it returns, checking the session every interval.
+// The lease is lost along with the session, e.g. when the database restarts.
+// Once `ctx` is done only the cancellation is ignored, errors of the cleanup `fn` does are returned.
+func (l *Lease) hold(ctx context.Context, conn *sql.Conn, fn func(context.Context) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	done := make(chan error, 1)
+	go func() {
+		done <- fn(ctx)
+	}()
+
+	ticker := time.NewTicker(l.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case err := <-done:
+			if ctx.Err() != nil && errors.Is(err, ctx.Err()) {
+				return nil
+			}
+			return err
+		case <-ticker.C:
+			if err := conn.PingContext(ctx); err != nil && ctx.Err() == nil {
+				l.logger.Error("lease lost", slog.String("lease", l.name), slog.Any("error", err))
+				cancel()
+				<-done
+				return errLeaseLost
+			}
+		}
+	}
+}
+
+func (l *Lease) release(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key); err != nil && !errors.Is(err, sql.ErrConnDone) {
+		l.logger.Warn("failed to release lease", slog.String("lease", l.name), slog.Any("error", err))
+	}
+	conn.Close()
+	l.logger.Info("lease released", slog.String("lease", l.name))
+}
+
+// leaseKey maps the name to an advisory lock key, see `migrationsLock` for the one taken by migrations
+func leaseKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte("waitlist:" + name))
+	return int64(h.Sum64())
+}
@@ -0,0 +1,138 @@
+package database_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/database"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+func TestLease(t *testing.T) {
+	postgresContainer, err := postgres.Run(t.Context(),
+		"postgres:18-alpine",
+		postgres.WithDatabase("waitlist"),
+		postgres.BasicWaitStrategies(),
+	)
+	t.Cleanup(func() {
+		if err := testcontainers.TerminateContainer(postgresContainer); err != nil {
+			t.Errorf("failed to terminate container: %s", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to start container: %s", err)
+	}
+
+	connectionString := postgresContainer.MustConnectionString(t.Context(), "sslmode=disable")
+	db, err := sql.Open("postgres", connectionString)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	newLease := func(name string) *database.Lease {
+		return database.NewLease(db, name, slog.Default(), database.WithLeaseInterval(time.Millisecond*50))
+	}
+
+	t.Run("only one holder runs at a time", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(t.Context())
+		started := make(chan int, 2)
+		done := make(chan error, 2)
+
+		for i := range 2 {
+			go func() {
+				done <- newLease("bot:1").Run(ctx, func(ctx context.Context) error {
+					started <- i
+					<-ctx.Done()
+					return ctx.Err()
+				})
+			}()
+		}
+
+		first := <-started
+		select {
+		case second := <-started:
+			t.Fatalf("expected one holder, got %d and %d", first, second)
+		case <-time.After(time.Millisecond * 300):
+		}
+
+		cancel()
+		for range 2 {
+			if err := <-done; err != nil {
+				t.Errorf("unexpected error %s", err)
+			}
+		}
+	})
+
+	t.Run("it hands over once released", func(t *testing.T) {
+		errDone := errors.New("done")
+		if err := newLease("bot:2").Run(t.Context(), func(ctx context.Context) error { return errDone }); !errors.Is(err, errDone) {
+			t.Fatalf("expected error of the holder, got %v", err)
+		}
+
+		ran := false
+		err := newLease("bot:2").Run(t.Context(), func(ctx context.Context) error {
+			ran = true
+			return nil
+		})
+		if err != nil || !ran {
+			t.Errorf("expected second holder to run, got %v", err)
+		}
+	})
+
+	t.Run("it retries failing holder", func(t *testing.T) {
+		errFailed := errors.New("failed")
+		runs := 0
+		err := database.NewLease(db, "bot:5", slog.Default(),
+			database.WithLeaseInterval(time.Millisecond*50),
+			database.WithLeaseRetry(time.Millisecond*100),
+		).Run(t.Context(), func(ctx context.Context) error {
+			if runs++; runs < 3 {
+				return errFailed
+			}
+			return nil
+		})
+		if err != nil || runs != 3 {
+			t.Errorf("expected holder to succeed on third run, got %d runs and %v", runs, err)
+		}
+	})
+
+	t.Run("it returns errors of the holder stopping", func(t *testing.T) {
+		errCommit := errors.New("failed to commit")
+		ctx, cancel := context.WithCancel(t.Context())
+		done := make(chan error, 1)
+		go func() {
+			done <- newLease("bot:6").Run(ctx, func(ctx context.Context) error {
+				cancel()
+				<-ctx.Done()
+				return errCommit
+			})
+		}()
+
+		if err := <-done; !errors.Is(err, errCommit) {
+			t.Errorf("expected error of the holder, got %v", err)
+		}
+	})
+
+	t.Run("different names do not block each other", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(t.Context(), time.Second*5)
+		defer cancel()
+
+		held := make(chan struct{})
+		go newLease("bot:3").Run(ctx, func(ctx context.Context) error {
+			close(held)
+			<-ctx.Done()
+			return nil
+		})
+		<-held
+
+		if err := newLease("bot:4").Run(ctx, func(ctx context.Context) error { return nil }); err != nil {
+			t.Error(err)
+		}
+	})
+}
@@ -0,0 +1,208 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"net/url"
+	"strings"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// migrationsLock is the advisory lock key held while migrating,
+// it must differ from the one `golang-migrate` takes internally
+const migrationsLock int64 = 0x77616974 // "wait"
+
+// MigrationStatus describes the schema version against the embedded migrations
+type MigrationStatus struct {
+	Version uint
+	Dirty   bool
+	Latest  uint
+	Pending []uint
+}
+
+// Migrator applies migrations from the `migrations` directory of the file system.
+// Every change is made holding a Postgres advisory lock, so replicas starting at once
+// migrate one by one instead of racing on `golang-migrate`.
+type Migrator struct {
+	url        string
+	migrations fs.FS
+	logger     *slog.Logger
+}
+
+func NewMigrator(url string, migrations fs.FS, logger *slog.Logger) *Migrator {
+	return &Migrator{
+		url:        url,
+		migrations: migrations,
+		logger:     logger,
+	}
+}
+
+func (m *Migrator) Up(ctx context.Context) error {
+	return m.locked(ctx, func(migrator *migrate.Migrate) error {
+		if err := migrator.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+			return fmt.Errorf("failed to migrate database: %w", err)
+		}
+		return nil
+	})
+}
+
+// Down rolls back `n` most recent migrations
+func (m *Migrator) Down(ctx context.Context, n int) error {
+	if n < 1 {
+		return fmt.Errorf("expected positive number of migrations to roll back, got %d", n)
+	}
+
+	return m.locked(ctx, func(migrator *migrate.Migrate) error {
+		if err := migrator.Steps(-n); err != nil {
+			return fmt.Errorf("failed to roll back database: %w", err)
+		}
+		return nil
+	})
+}
+
+// Force sets the schema version and clears the dirty flag without running any migration,
+// e.g. after fixing a failed migration by hand
+func (m *Migrator) Force(ctx context.Context, version int) error {
+	return m.locked(ctx, func(migrator *migrate.Migrate) error {
+		if err := migrator.Force(version); err != nil {
+			return fmt.Errorf("failed to force version %d: %w", version, err)
+		}
+		return nil
+	})
+}
+
+func (m *Migrator) Status(ctx context.Context) (MigrationStatus, error) {
+	var status MigrationStatus
+	versions, err := versions(m.migrations)
+	if err != nil {
+		return status, err
+	}
+
+	err = m.run(func(migrator *migrate.Migrate) error {
+		version, dirty, err := migrator.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			return nil
+		}
+		status.Version, status.Dirty = version, dirty
+		return err
+	})
+	if err != nil {
+		return status, fmt.Errorf("failed to read schema version: %w", err)
+	}
+
+	status.Pending = []uint{}
+	for _, v := range versions {
+		if v > status.Version {
+			status.Pending = append(status.Pending, v)
+		}
+	}
+	status.Latest = versions[len(versions)-1]
+	return status, nil
+}
+
+// locked runs `fn` holding the advisory lock on a dedicated connection,
+// waiting for other replicas to finish first
+func (m *Migrator) locked(ctx context.Context, fn func(*migrate.Migrate) error) error {
+	db, err := sql.Open("postgres", m.url)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect database: %w", err)
+	}
+	defer conn.Close()
+
+	m.logger.DebugContext(ctx, "acquiring migrations lock")
+	if _, err := conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationsLock); err != nil {
+		return fmt.Errorf("failed to acquire migrations lock: %w", err)
+	}
+	defer func() {
+		// the lock is released with the session anyway, this only makes it faster
+		if _, err := conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationsLock); err != nil {
+			m.logger.Error("failed to release migrations lock", slog.Any("error", err))
+		}
+	}()
+
+	return m.run(fn)
+}
+
+func (m *Migrator) run(fn func(*migrate.Migrate) error) error {
+	source, err := iofs.New(m.migrations, "migrations")
+	if err != nil {
+		return fmt.Errorf("failed to create source: %w", err)
+	}
+
+	migrator, err := migrate.NewWithSourceInstance("iofs", source, m.url)
+	if err != nil {
+		// `golang-migrate` puts the url into the error, password included
+		if u, parseErr := url.Parse(m.url); parseErr == nil {
+			return fmt.Errorf("failed to create migration source: %s", strings.ReplaceAll(err.Error(), m.url, u.Redacted()))
+		}
+		return fmt.Errorf("failed to create migration source: %w", err)
+	}
+	defer migrator.Close()
+
+	return fn(migrator)
+}
+
+// Migrated reports an error until every embedded migration is applied cleanly. A schema newer than
+// the embedded migrations is fine, e.g. while the previous release is still serving during a rollout.
+func Migrated(db *sql.DB, migrations fs.FS) func(context.Context) error {
+	return func(ctx context.Context) error {
+		versions, err := versions(migrations)
+		if err != nil {
+			return err
+		}
+		latest := versions[len(versions)-1]
+
+		var version uint
+		var dirty bool
+		err = db.QueryRowContext(ctx, "SELECT version, dirty FROM schema_migrations LIMIT 1").Scan(&version, &dirty)
+		if err != nil {
+			return fmt.Errorf("failed to read schema version: %w", err)
+		}
+
+		if dirty {
+			return fmt.Errorf("migration %d failed, the schema is dirty", version)
+		}
+
+		if version < latest {
+			return fmt.Errorf("schema version %d, expected %d", version, latest)
+		}
+		return nil
+	}
+}
+
+// versions lists the embedded migrations in ascending order
+func versions(migrations fs.FS) ([]uint, error) {
+	source, err := iofs.New(migrations, "migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to create source: %w", err)
+	}
+	defer source.Close()
+
+	version, err := source.First()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	versions := []uint{version}
+	for {
+		version, err = source.Next(version)
+		if err != nil {
+			break
+		}
+		versions = append(versions, version)
+	}
+	return versions, nil
+}
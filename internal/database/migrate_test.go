@@ -0,0 +1,138 @@
+package database_test
+
+import (
+	"database/sql"
+	"log/slog"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/ailinykh/waitlist/internal/database"
+	"github.com/testcontainers/testcontainers-go"
+	"github.com/testcontainers/testcontainers-go/modules/postgres"
+)
+
+func TestMigrator(t *testing.T) {
+	postgresContainer, err := postgres.Run(t.Context(),
+		"postgres:18-alpine",
+		postgres.WithDatabase("waitlist"),
+		postgres.BasicWaitStrategies(),
+	)
+	t.Cleanup(func() {
+		if err := testcontainers.TerminateContainer(postgresContainer); err != nil {
+			t.Errorf("failed to terminate container: %s", err)
+		}
+	})
+	if err != nil {
+		t.Fatalf("failed to start container: %s", err)
+	}
+
+	connectionString := postgresContainer.MustConnectionString(t.Context(), "sslmode=disable")
+	migrator := database.NewMigrator(connectionString, os.DirFS("../.."), slog.Default())
+
+	t.Run("replicas migrate one by one", func(t *testing.T) {
+		var wg sync.WaitGroup
+		errs := make([]error, 3)
+		for i := range errs {
+			wg.Go(func() {
+				errs[i] = migrator.Up(t.Context())
+			})
+		}
+		wg.Wait()
+
+		for _, err := range errs {
+			if err != nil {
+				t.Errorf("failed to migrate: %s", err)
+			}
+		}
+
+		status, err := migrator.Status(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status.Version != status.Latest || status.Dirty || len(status.Pending) > 0 {
+			t.Errorf("expected schema to be up to date, got %+v", status)
+		}
+	})
+
+	t.Run("it rolls back migrations", func(t *testing.T) {
+		before, err := migrator.Status(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := migrator.Down(t.Context(), 1); err != nil {
+			t.Fatal(err)
+		}
+
+		after, err := migrator.Status(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if after.Version >= before.Version || !slices.Equal(after.Pending, []uint{before.Latest}) {
+			t.Errorf("expected latest migration to be rolled back, got %+v", after)
+		}
+	})
+
+	t.Run("it forces version", func(t *testing.T) {
+		status, err := migrator.Status(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if err := migrator.Force(t.Context(), int(status.Latest)); err != nil {
+			t.Fatal(err)
+		}
+
+		status, err = migrator.Status(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if status.Version != status.Latest {
+			t.Errorf("expected forced version %d, got %d", status.Latest, status.Version)
+		}
+	})
+
+	t.Run("it is ready unless the schema is behind or dirty", func(t *testing.T) {
+		db, err := sql.Open("postgres", connectionString)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { db.Close() })
+
+		status, err := migrator.Status(t.Context())
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		migrated := database.Migrated(db, os.DirFS("../.."))
+		if err := migrated(t.Context()); err != nil {
+			t.Errorf("expected up to date schema to be ready, got %s", err)
+		}
+
+		if err := migrator.Force(t.Context(), int(status.Latest)+1); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrated(t.Context()); err != nil {
+			t.Errorf("expected newer schema to be ready, got %s", err)
+		}
+
+		if err := migrator.Force(t.Context(), int(status.Latest)-1); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrated(t.Context()); err == nil {
+			t.Error("expected outdated schema not to be ready")
+		}
+
+		if _, err := db.ExecContext(t.Context(), "UPDATE schema_migrations SET dirty = true"); err != nil {
+			t.Fatal(err)
+		}
+		if err := migrated(t.Context()); err == nil {
+			t.Error("expected dirty schema not to be ready")
+		}
+	})
+}
@@ -0,0 +1,148 @@
+package filter
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/repository"
+)
+
+// Message is an incoming bot message to be checked before it gets into the waitlist
+type Message struct {
+	UserID      int64
+	BotUsername string
+	Text        string
+	// Entities are Telegram message entity types, e.g. "url" or "text_link"
+	Entities []string
+}
+
+// Filter returns a non-empty reason when the message should be flagged
+type Filter interface {
+	Check(ctx context.Context, msg Message) (string, error)
+}
+
+type FilterFunc func(ctx context.Context, msg Message) (string, error)
+
+func (f FilterFunc) Check(ctx context.Context, msg Message) (string, error) {
+	return f(ctx, msg)
+}
+
+// Chain runs filters in order and stops at the first one flagging the message
+type Chain []Filter
+
+func (c Chain) Check(ctx context.Context, msg Message) (string, error) {
+	for _, f := range c {
+		reason, err := f.Check(ctx, msg)
+		if err != nil || len(reason) > 0 {
+			return reason, err
+		}
+	}
+	return "", nil
+}
+
+func MaxLength(n int) Filter {
+	return FilterFunc(func(ctx context.Context, msg Message) (string, error) {
+		if len([]rune(msg.Text)) > n {
+			return fmt.Sprintf("message is longer than %d characters", n), nil
+		}
+		return "", nil
+	})
+}
+
+var linkRegexp = regexp.MustCompile(`(?i)(https?://|www\.|t\.me/|\b[a-z0-9-]+\.(com|net|org|ru|io|me|xyz|info|biz|top)\b)`)
+
+// Links flags messages with links, either detected by Telegram or matching well-known patterns
+func Links() Filter {
+	return FilterFunc(func(ctx context.Context, msg Message) (string, error) {
+		if slices.Contains(msg.Entities, "url") || slices.Contains(msg.Entities, "text_link") || linkRegexp.MatchString(msg.Text) {
+			return "message contains a link", nil
+		}
+		return "", nil
+	})
+}
+
+type RepeatsRepo interface {
+	CountRepeatedEntries(ctx context.Context, arg repository.CountRepeatedEntriesParams) (int64, error)
+}
+
+// Repeats flags a message once the user has sent the same text `max` times within `window`
+func Repeats(repo RepeatsRepo, max int64, window time.Duration, clock clock.Clock) Filter {
+	return FilterFunc(func(ctx context.Context, msg Message) (string, error) {
+		count, err := repo.CountRepeatedEntries(ctx, repository.CountRepeatedEntriesParams{
+			UserID:      msg.UserID,
+			BotUsername: msg.BotUsername,
+			Message:     msg.Text,
+			CreatedAt:   clock.Now().Add(-window),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to count repeated entries: %w", err)
+		}
+
+		if count >= max {
+			return "message is repeated", nil
+		}
+		return "", nil
+	})
+}
+
+type BannedWordsRepo interface {
+	GetBannedWords(ctx context.Context, botUsername string) ([]string, error)
+}
+
+// BannedWords flags messages containing any of the words banned for the bot, case insensitive.
+// Only whole words match, so a banned "ass" does not flag "class", and a banned phrase matches its words in a row
+func BannedWords(repo BannedWordsRepo) Filter {
+	return FilterFunc(func(ctx context.Context, msg Message) (string, error) {
+		words, err := repo.GetBannedWords(ctx, msg.BotUsername)
+		if err != nil {
+			return "", fmt.Errorf("failed to get banned words: %w", err)
+		}
+
+		text := tokens(msg.Text)
+		for _, word := range words {
+			banned := tokens(word)
+			if len(banned) == 0 {
+				continue
+			}
+
+			for i := 0; i+len(banned) <= len(text); i++ {
+				if slices.Equal(text[i:i+len(banned)], banned) {
+					return fmt.Sprintf("message contains banned word %q", word), nil
+				}
+			}
+		}
+		return "", nil
+	})
+}
+
+// tokens splits lowercased text into words of letters and digits
+func tokens(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+}
+
+type BlocklistRepo interface {
+	IsUserBlocked(ctx context.Context, userID int64) (bool, error)
+}
+
+// Blocklist flags every message of the users blocked by admins
+func Blocklist(repo BlocklistRepo) Filter {
+	return FilterFunc(func(ctx context.Context, msg Message) (string, error) {
+		blocked, err := repo.IsUserBlocked(ctx, msg.UserID)
+		if err != nil {
+			return "", fmt.Errorf("failed to check blocklist: %w", err)
+		}
+
+		if blocked {
+			return "user is blocked", nil
+		}
+		return "", nil
+	})
+}
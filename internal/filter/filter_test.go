@@ -0,0 +1,72 @@
+package filter_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/filter"
+	"github.com/ailinykh/waitlist/internal/repository"
+)
+
+type repoStub struct {
+	words   []string
+	blocked bool
+	repeats int64
+}
+
+func (r repoStub) GetBannedWords(ctx context.Context, botUsername string) ([]string, error) {
+	return r.words, nil
+}
+
+func (r repoStub) IsUserBlocked(ctx context.Context, userID int64) (bool, error) {
+	return r.blocked, nil
+}
+
+func (r repoStub) CountRepeatedEntries(ctx context.Context, arg repository.CountRepeatedEntriesParams) (int64, error) {
+	return r.repeats, nil
+}
+
+func TestChain(t *testing.T) {
+	chain := func(repo repoStub) filter.Chain {
+		return filter.Chain{
+			filter.Blocklist(repo),
+			filter.MaxLength(10),
+			filter.Links(),
+			filter.BannedWords(repo),
+			filter.Repeats(repo, 3, time.Hour, clock.New()),
+		}
+	}
+
+	cases := []struct {
+		name   string
+		repo   repoStub
+		msg    filter.Message
+		reason string
+	}{
+		{"it passes regular messages", repoStub{}, filter.Message{Text: "/start"}, ""},
+		{"it flags blocked users", repoStub{blocked: true}, filter.Message{Text: "/start"}, "user is blocked"},
+		{"it flags long messages", repoStub{}, filter.Message{Text: strings.Repeat("a", 11)}, "message is longer than 10 characters"},
+		{"it flags links in text", repoStub{}, filter.Message{Text: "t.me/spam"}, "message contains a link"},
+		{"it flags links detected by telegram", repoStub{}, filter.Message{Text: "click", Entities: []string{"text_link"}}, "message contains a link"},
+		{"it flags banned words", repoStub{words: []string{"casino"}}, filter.Message{Text: "CASINO!"}, `message contains banned word "casino"`},
+		{"it matches banned words as a whole", repoStub{words: []string{"ass"}}, filter.Message{Text: "class"}, ""},
+		{"it flags banned phrases", repoStub{words: []string{"Top Job"}}, filter.Message{Text: "a top, job"}, `message contains banned word "Top Job"`},
+		{"it flags repeated messages", repoStub{repeats: 3}, filter.Message{Text: "/start"}, "message is repeated"},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			reason, err := chain(c.repo).Check(t.Context(), c.msg)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if reason != c.reason {
+				t.Errorf("expected reason '%s', got '%s'", c.reason, reason)
+			}
+		})
+	}
+}
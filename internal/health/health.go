@@ -0,0 +1,107 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/clock"
+)
+
+type Status string
+
+const (
+	StatusOK   Status = "ok"
+	StatusFail Status = "fail"
+)
+
+// Check reports a component as healthy by returning nil
+type Check func(ctx context.Context) error
+
+// Checks are keyed by component name, e.g. `database` or `bot:<id>`
+type Checks map[string]Check
+
+type Component struct {
+	Status   Status `json:"status"`
+	Error    string `json:"error,omitempty"`
+	Duration string `json:"duration"`
+}
+
+type Report struct {
+	Status     Status               `json:"status"`
+	Components map[string]Component `json:"components"`
+}
+
+// Run executes all the checks concurrently, every check is given at most `timeout` to complete
+func (c Checks) Run(ctx context.Context, timeout time.Duration) Report {
+	report := Report{
+		Status:     StatusOK,
+		Components: make(map[string]Component, len(c)),
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for name, check := range c {
+		wg.Go(func() {
+			ctx, cancel := context.WithTimeout(ctx, timeout)
+			defer cancel()
+
+			start := time.Now()
+			err := check(ctx)
+			component := Component{
+				Status:   StatusOK,
+				Duration: time.Since(start).String(),
+			}
+			if err != nil {
+				component.Status = StatusFail
+				component.Error = err.Error()
+			}
+
+			mu.Lock()
+			defer mu.Unlock()
+			report.Components[name] = component
+			if err != nil {
+				report.Status = StatusFail
+			}
+		})
+	}
+	wg.Wait()
+
+	return report
+}
+
+// Heartbeat remembers the last time a background worker succeeded, see `Heartbeat.Check`
+type Heartbeat struct {
+	clock clock.Clock
+	last  atomic.Int64
+}
+
+func NewHeartbeat(clock clock.Clock) *Heartbeat {
+	return &Heartbeat{clock: clock}
+}
+
+// Beat is safe to call on a nil `*Heartbeat`
+func (h *Heartbeat) Beat() {
+	if h == nil {
+		return
+	}
+	h.last.Store(h.clock.Now().UnixNano())
+}
+
+// Check fails until the first beat and once the last one is older than `maxAge`
+func (h *Heartbeat) Check(maxAge time.Duration) Check {
+	return func(ctx context.Context) error {
+		last := h.last.Load()
+		if last == 0 {
+			return errors.New("no successful run yet")
+		}
+
+		if age := h.clock.Now().Sub(time.Unix(0, last)); age > maxAge {
+			return fmt.Errorf("last successful run %s ago", age.Truncate(time.Second))
+		}
+		return nil
+	}
+}
@@ -0,0 +1,94 @@
+package health_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/health"
+)
+
+func TestChecks(t *testing.T) {
+	t.Run("it reports ok when every check passes", func(t *testing.T) {
+		report := health.Checks{
+			"database": func(context.Context) error { return nil },
+			"cache":    func(context.Context) error { return nil },
+		}.Run(t.Context(), time.Second)
+
+		if report.Status != health.StatusOK {
+			t.Errorf("expected %s, got %s", health.StatusOK, report.Status)
+		}
+
+		if len(report.Components) != 2 {
+			t.Errorf("expected 2 components, got %d", len(report.Components))
+		}
+	})
+
+	t.Run("it reports failed component", func(t *testing.T) {
+		report := health.Checks{
+			"database": func(context.Context) error { return nil },
+			"bot:1":    func(context.Context) error { return errors.New("not polled") },
+		}.Run(t.Context(), time.Second)
+
+		if report.Status != health.StatusFail {
+			t.Errorf("expected %s, got %s", health.StatusFail, report.Status)
+		}
+
+		if c := report.Components["database"]; c.Status != health.StatusOK {
+			t.Errorf("expected database to be ok, got %v", c)
+		}
+
+		if c := report.Components["bot:1"]; c.Status != health.StatusFail || c.Error != "not polled" {
+			t.Errorf("expected bot to fail, got %v", c)
+		}
+	})
+
+	t.Run("it limits check duration", func(t *testing.T) {
+		report := health.Checks{
+			"slow": func(ctx context.Context) error {
+				<-ctx.Done()
+				return ctx.Err()
+			},
+		}.Run(t.Context(), time.Millisecond)
+
+		if report.Status != health.StatusFail {
+			t.Errorf("expected %s, got %s", health.StatusFail, report.Status)
+		}
+	})
+}
+
+func TestHeartbeat(t *testing.T) {
+	clock := clock.NewFake(time.Date(2013, 8, 14, 22, 0, 0, 0, time.UTC))
+	heartbeat := health.NewHeartbeat(clock)
+	check := heartbeat.Check(time.Minute)
+
+	t.Run("it fails before the first beat", func(t *testing.T) {
+		if err := check(t.Context()); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("it passes after a beat", func(t *testing.T) {
+		heartbeat.Beat()
+		clock.Add(time.Second * 30)
+
+		if err := check(t.Context()); err != nil {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+
+	t.Run("it fails once the beat is stale", func(t *testing.T) {
+		clock.Add(time.Minute)
+
+		if err := check(t.Context()); err == nil {
+			t.Error("expected error")
+		}
+	})
+
+	t.Run("it tolerates nil heartbeat", func(t *testing.T) {
+		var heartbeat *health.Heartbeat
+		heartbeat.Beat()
+	})
+}
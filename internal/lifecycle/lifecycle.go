@@ -0,0 +1,173 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Manager runs the components of the process and stops them in order: the running components
+// are canceled and waited for, then the stop hooks are called in reverse order, e.g. the database
+// is closed once nothing uses it. The whole shutdown is limited by the timeout,
+// the components and hooks still running by then are reported.
+type Manager struct {
+	logger  *slog.Logger
+	timeout time.Duration
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	drain  context.Context
+	expire context.CancelFunc
+
+	wg      sync.WaitGroup
+	mu      sync.Mutex
+	running map[string]int
+	hooks   []hook
+	errs    []error
+}
+
+type hook struct {
+	name string
+	stop func(context.Context) error
+}
+
+type drainKey struct{}
+
+func New(logger *slog.Logger, timeout time.Duration) *Manager {
+	ctx, cancel := context.WithCancel(context.Background())
+	drain, expire := context.WithCancel(context.Background())
+	return &Manager{
+		logger:  logger,
+		timeout: timeout,
+		ctx:     context.WithValue(ctx, drainKey{}, drain),
+		cancel:  cancel,
+		drain:   drain,
+		expire:  expire,
+		running: map[string]int{},
+	}
+}
+
+// Go runs the component until shutdown, `run` is expected to stop accepting work once its context is done
+// and return after finishing the work in progress, see `DrainContext`. A component failing on its own
+// shuts the whole process down, so it can be restarted.
+func (m *Manager) Go(name string, run func(ctx context.Context) error) {
+	m.mu.Lock()
+	m.running[name]++
+	m.mu.Unlock()
+
+	m.wg.Go(func() {
+		err := run(m.ctx)
+
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		if m.running[name]--; m.running[name] == 0 {
+			delete(m.running, name)
+		}
+
+		if err != nil && m.ctx.Err() == nil {
+			m.logger.Error("component failed", slog.String("component", name), slog.Any("error", err))
+			m.errs = append(m.errs, fmt.Errorf("%s: %w", name, err))
+			m.cancel()
+		}
+	})
+}
+
+// OnStop registers a hook called once all the components have returned, hooks are called in reverse order
+func (m *Manager) OnStop(name string, stop func(ctx context.Context) error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.hooks = append(m.hooks, hook{name, stop})
+}
+
+// Wait blocks until `ctx` is done or a component fails, then shuts everything down.
+// The error reports failed components and the ones that blocked the shutdown.
+func (m *Manager) Wait(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+	case <-m.ctx.Done():
+	}
+
+	m.logger.Info("shutting down", slog.Duration("timeout", m.timeout))
+	m.cancel()
+	timer := time.AfterFunc(m.timeout, m.expire)
+	defer timer.Stop()
+
+	done := make(chan struct{})
+	go func() {
+		m.wg.Wait()
+		close(done)
+	}()
+
+	var errs []error
+	select {
+	case <-done:
+	case <-m.drain.Done():
+		m.mu.Lock()
+		blocked := slices.Sorted(maps.Keys(m.running))
+		m.mu.Unlock()
+		errs = append(errs, m.blocked(blocked...))
+	}
+
+	m.mu.Lock()
+	hooks := slices.Clone(m.hooks)
+	m.mu.Unlock()
+
+	for _, h := range slices.Backward(hooks) {
+		if err := m.stop(h); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return errors.Join(append(m.errs, errs...)...)
+}
+
+func (m *Manager) stop(h hook) error {
+	stopped := make(chan error, 1)
+	go func() {
+		stopped <- h.stop(m.drain)
+	}()
+
+	var err error
+	select {
+	case err = <-stopped:
+	case <-m.drain.Done():
+		select {
+		case err = <-stopped:
+		default:
+			return m.blocked(h.name)
+		}
+	}
+
+	if err != nil {
+		m.logger.Error("failed to stop", slog.String("component", h.name), slog.Any("error", err))
+		return fmt.Errorf("%s: %w", h.name, err)
+	}
+	return nil
+}
+
+func (m *Manager) blocked(names ...string) error {
+	m.logger.Error("shutdown timed out", slog.Any("blocked_by", names))
+	return fmt.Errorf("shutdown timed out in %s, blocked by %s", m.timeout, strings.Join(names, ", "))
+}
+
+// DrainContext keeps the values of the component context, e.g. the trace span, but is only canceled
+// once the shutdown times out, so the work in progress can be finished. Outside of `Manager` it is never canceled.
+func DrainContext(ctx context.Context) (context.Context, context.CancelFunc) {
+	drained, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	if drain, ok := ctx.Value(drainKey{}).(context.Context); ok {
+		stop := context.AfterFunc(drain, cancel)
+		return drained, func() {
+			stop()
+			cancel()
+		}
+	}
+	return drained, cancel
+}
@@ -0,0 +1,129 @@
+package lifecycle_test
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/lifecycle"
+)
+
+func TestManager(t *testing.T) {
+	t.Run("it stops components before hooks in reverse order", func(t *testing.T) {
+		m := lifecycle.New(slog.Default(), time.Second)
+
+		var mu sync.Mutex
+		stopped := []string{}
+		record := func(name string) {
+			mu.Lock()
+			defer mu.Unlock()
+			stopped = append(stopped, name)
+		}
+
+		m.Go("server", func(ctx context.Context) error {
+			<-ctx.Done()
+			record("server")
+			return ctx.Err()
+		})
+		m.OnStop("database", func(ctx context.Context) error {
+			record("database")
+			return nil
+		})
+		m.OnStop("tracing", func(ctx context.Context) error {
+			record("tracing")
+			return nil
+		})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		if err := m.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if expected := []string{"server", "tracing", "database"}; !slices.Equal(stopped, expected) {
+			t.Errorf("expected %v, got %v", expected, stopped)
+		}
+	})
+
+	t.Run("it lets components drain until the timeout", func(t *testing.T) {
+		m := lifecycle.New(slog.Default(), time.Millisecond*200)
+
+		drained := make(chan error, 1)
+		m.Go("bot", func(ctx context.Context) error {
+			<-ctx.Done()
+			ctx, cancel := lifecycle.DrainContext(ctx)
+			defer cancel()
+
+			select {
+			case <-ctx.Done():
+				drained <- errors.New("drain context canceled too early")
+			case <-time.After(time.Millisecond * 50):
+				drained <- nil
+			}
+			return nil
+		})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		if err := m.Wait(ctx); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := <-drained; err != nil {
+			t.Error(err)
+		}
+	})
+
+	t.Run("it reports what blocks the shutdown", func(t *testing.T) {
+		m := lifecycle.New(slog.Default(), time.Millisecond*50)
+
+		block := make(chan struct{})
+		defer close(block)
+
+		m.Go("bot:1", func(ctx context.Context) error {
+			<-block
+			return nil
+		})
+		m.Go("server", func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+		m.OnStop("database", func(ctx context.Context) error {
+			<-block
+			return nil
+		})
+
+		ctx, cancel := context.WithCancel(t.Context())
+		cancel()
+		err := m.Wait(ctx)
+		if err == nil {
+			t.Fatal("expected error")
+		}
+
+		if !strings.Contains(err.Error(), "blocked by bot:1\n") || !strings.Contains(err.Error(), "blocked by database") {
+			t.Errorf("unexpected error %s", err)
+		}
+	})
+
+	t.Run("it shuts down when a component fails", func(t *testing.T) {
+		m := lifecycle.New(slog.Default(), time.Second)
+
+		m.Go("server", func(ctx context.Context) error {
+			return errors.New("address already in use")
+		})
+		m.Go("bot:1", func(ctx context.Context) error {
+			<-ctx.Done()
+			return nil
+		})
+
+		err := m.Wait(t.Context())
+		if err == nil || !strings.Contains(err.Error(), "server: address already in use") {
+			t.Errorf("unexpected error %v", err)
+		}
+	})
+}
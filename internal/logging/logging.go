@@ -0,0 +1,132 @@
+package logging
+
+import (
+	"context"
+	"io"
+	"log/slog"
+	"regexp"
+	"strings"
+
+	"go.opentelemetry.io/otel/trace"
+)
+
+type requestIDKey struct{}
+
+// WithRequestID stores the request id in the context, so every `slog` call made with the context carries it
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// New creates a logger writing either JSON or text records with secrets redacted
+func New(w io.Writer, level slog.Leveler, json bool, replace ...func([]string, slog.Attr) slog.Attr) *slog.Logger {
+	opts := &slog.HandlerOptions{
+		Level:     level,
+		AddSource: true,
+		ReplaceAttr: func(groups []string, a slog.Attr) slog.Attr {
+			for _, r := range replace {
+				a = r(groups, a)
+			}
+			return Redact(groups, a)
+		},
+	}
+
+	var h slog.Handler = slog.NewTextHandler(w, opts)
+	if json {
+		h = slog.NewJSONHandler(w, opts)
+	}
+	return slog.New(NewHandler(h))
+}
+
+// NewHandler adds `request_id` and `trace_id` from the context to every record
+func NewHandler(next slog.Handler) slog.Handler {
+	return &contextHandler{next}
+}
+
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); len(id) > 0 {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	if sc := trace.SpanContextFromContext(ctx); sc.IsValid() {
+		r.AddAttrs(slog.String("trace_id", sc.TraceID().String()))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+const redacted = "[REDACTED]"
+
+var sensitiveKeys = []string{"token", "refresh_token", "authorization", "cookie", "hash", "secret", "password", "init_data"}
+
+var sensitivePatterns = []*regexp.Regexp{
+	// JWT
+	regexp.MustCompile(`eyJ[\w-]*\.[\w-]*\.[\w-]*`),
+	// Telegram bot token, e.g. in Bot API urls
+	regexp.MustCompile(`\d{5,}:[\w-]{30,}`),
+	regexp.MustCompile(`(?i)(bearer\s+)\S+`),
+	regexp.MustCompile(`(?i)((?:hash|token|secret)=)[^&\s]+`),
+}
+
+// Redact is `slog.HandlerOptions.ReplaceAttr` masking tokens, hashes and secrets,
+// either by the attribute key or by the well-known patterns in string and error values
+func Redact(groups []string, a slog.Attr) slog.Attr {
+	key := strings.ToLower(a.Key)
+	for _, k := range sensitiveKeys {
+		if key == k || strings.HasSuffix(key, "_"+k) {
+			return slog.String(a.Key, redacted)
+		}
+	}
+
+	switch a.Value.Kind() {
+	case slog.KindString:
+		return slog.String(a.Key, redactString(a.Value.String()))
+	case slog.KindAny:
+		if err, ok := a.Value.Any().(error); ok {
+			return slog.String(a.Key, redactString(err.Error()))
+		}
+	}
+	return a
+}
+
+func redactString(s string) string {
+	for _, p := range sensitivePatterns {
+		if p.NumSubexp() > 0 {
+			s = p.ReplaceAllString(s, "${1}"+redacted)
+		} else {
+			s = p.ReplaceAllString(s, redacted)
+		}
+	}
+	return s
+}
+
+// Mask keeps the first and the last two characters of a secret for logged configs, short ones are masked entirely
+func Mask(secret string) string {
+	if len(secret) < 5 {
+		return strings.Repeat("*", len(secret))
+	}
+	return secret[:2] + strings.Repeat("*", len(secret)-4) + secret[len(secret)-2:]
+}
+
+// MaskAll masks every secret of the list
+func MaskAll(secrets []string) []string {
+	masked := []string{}
+	for _, secret := range secrets {
+		masked = append(masked, Mask(secret))
+	}
+	return masked
+}
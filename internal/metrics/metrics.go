@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"database/sql"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const namespace = "waitlist"
+
+// Metrics collects HTTP, bot and database metrics in its own registry.
+// All methods are safe to call on a nil `*Metrics`, so the instrumentation is optional.
+type Metrics struct {
+	registry *prometheus.Registry
+
+	httpRequests *prometheus.CounterVec
+	httpDuration *prometheus.HistogramVec
+
+	botUpdates      *prometheus.CounterVec
+	botEntries      *prometheus.CounterVec
+	botMessagesSent *prometheus.CounterVec
+	botAPIErrors    *prometheus.CounterVec
+	botPollDuration *prometheus.HistogramVec
+}
+
+func New() *Metrics {
+	m := &Metrics{
+		registry: prometheus.NewRegistry(),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "http_requests_total",
+			Help:      "HTTP requests by route and status code.",
+		}, []string{"method", "route", "status"}),
+		httpDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "HTTP request latency by route and status code.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"method", "route", "status"}),
+		botUpdates: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bot_updates_received_total",
+			Help:      "Telegram updates received by the bot.",
+		}, []string{"bot"}),
+		botEntries: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bot_entries_created_total",
+			Help:      "Waitlist entries saved by the bot.",
+		}, []string{"bot", "flagged"}),
+		botMessagesSent: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bot_messages_sent_total",
+			Help:      "Messages sent by the bot.",
+		}, []string{"bot"}),
+		botAPIErrors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "bot_telegram_api_errors_total",
+			Help:      "Failed Telegram Bot API calls by method.",
+		}, []string{"bot", "method"}),
+		botPollDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "bot_poll_duration_seconds",
+			Help:      "Latency of `getUpdates` long polling.",
+			Buckets:   []float64{0.1, 0.5, 1, 5, 10, 30, 60, 120},
+		}, []string{"bot"}),
+	}
+
+	m.registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+		m.httpRequests,
+		m.httpDuration,
+		m.botUpdates,
+		m.botEntries,
+		m.botMessagesSent,
+		m.botAPIErrors,
+		m.botPollDuration,
+	)
+	return m
+}
+
+// RegisterDB exposes connection pool stats from `sql.DB.Stats()`
+func (m *Metrics) RegisterDB(db *sql.DB, name string) error {
+	if m == nil {
+		return nil
+	}
+	return m.registry.Register(collectors.NewDBStatsCollector(db, name))
+}
+
+// Handler serves the metrics in Prometheus text format
+func (m *Metrics) Handler() http.Handler {
+	if m == nil {
+		return http.NotFoundHandler()
+	}
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{Registry: m.registry})
+}
+
+func (m *Metrics) ObserveRequest(method, route string, status int, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	code := strconv.Itoa(status)
+	m.httpRequests.WithLabelValues(method, route, code).Inc()
+	m.httpDuration.WithLabelValues(method, route, code).Observe(duration.Seconds())
+}
+
+func (m *Metrics) UpdatesReceived(bot string, count int) {
+	if m == nil {
+		return
+	}
+	m.botUpdates.WithLabelValues(bot).Add(float64(count))
+}
+
+func (m *Metrics) EntryCreated(bot string, flagged bool) {
+	if m == nil {
+		return
+	}
+	m.botEntries.WithLabelValues(bot, strconv.FormatBool(flagged)).Inc()
+}
+
+func (m *Metrics) MessageSent(bot string) {
+	if m == nil {
+		return
+	}
+	m.botMessagesSent.WithLabelValues(bot).Inc()
+}
+
+func (m *Metrics) TelegramAPIError(bot, method string) {
+	if m == nil {
+		return
+	}
+	m.botAPIErrors.WithLabelValues(bot, method).Inc()
+}
+
+func (m *Metrics) ObservePoll(bot string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.botPollDuration.WithLabelValues(bot).Observe(duration.Seconds())
+}
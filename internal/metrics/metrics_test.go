@@ -0,0 +1,64 @@
+package metrics_test
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/metrics"
+)
+
+func TestMetrics(t *testing.T) {
+	m := metrics.New()
+	m.ObserveRequest("GET", "/api/entries", 200, time.Millisecond)
+	m.UpdatesReceived("test_bot", 3)
+	m.EntryCreated("test_bot", true)
+	m.MessageSent("test_bot")
+	m.TelegramAPIError("test_bot", "sendMessage")
+	m.ObservePoll("test_bot", time.Second)
+
+	body := scrape(t, m)
+	for _, expected := range []string{
+		`waitlist_http_requests_total{method="GET",route="/api/entries",status="200"} 1`,
+		`waitlist_http_request_duration_seconds_count{method="GET",route="/api/entries",status="200"} 1`,
+		`waitlist_bot_updates_received_total{bot="test_bot"} 3`,
+		`waitlist_bot_entries_created_total{bot="test_bot",flagged="true"} 1`,
+		`waitlist_bot_messages_sent_total{bot="test_bot"} 1`,
+		`waitlist_bot_telegram_api_errors_total{bot="test_bot",method="sendMessage"} 1`,
+		`waitlist_bot_poll_duration_seconds_count{bot="test_bot"} 1`,
+	} {
+		if !strings.Contains(body, expected) {
+			t.Errorf("expected metrics to contain %q", expected)
+		}
+	}
+}
+
+func TestNilMetrics(t *testing.T) {
+	var m *metrics.Metrics
+	m.ObserveRequest("GET", "/", 200, time.Millisecond)
+	m.EntryCreated("test_bot", false)
+
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("expected %d, got %d", http.StatusNotFound, rec.Code)
+	}
+}
+
+func scrape(t testing.TB, m *metrics.Metrics) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	m.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("expected %d, got %d", http.StatusOK, rec.Code)
+	}
+
+	data, err := io.ReadAll(rec.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
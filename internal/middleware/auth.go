@@ -2,52 +2,101 @@ package middleware
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
 	"fmt"
 	"log/slog"
 	"net/http"
+	"time"
 
 	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/permission"
 	"github.com/ailinykh/waitlist/pkg/jwt"
 )
 
-func JwtAuth(jwtSecret string, contextKey any, clock clock.Clock, logger *slog.Logger) Middleware {
+// AuthCookie holds the access token for browser sessions, see `JwtAuth`
+const AuthCookie = "auth"
+
+// RevocationList reports whether tokens of the user issued at or before `issuedAt` were revoked
+type RevocationList interface {
+	IsRevoked(ctx context.Context, userID int64, issuedAt time.Time) (bool, error)
+}
+
+// JwtAuth accepts the token either from `Authorization: Bearer` header or from `AuthCookie`
+func JwtAuth(keys *jwt.KeySet, contextKey any, revocations RevocationList, clock clock.Clock, logger *slog.Logger, opts ...func(*jwt.Validation)) Middleware {
+	opts = append([]func(*jwt.Validation){jwt.WithClock(clock)}, opts...)
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			auth := r.Header.Get("Authorization")
-			if len(auth) < 7 {
-				logger.Error("no auth header passed", slog.String("authorization", auth))
+			token, ok := tokenFromRequest(r)
+			if !ok {
+				logger.ErrorContext(r.Context(), "no auth header or cookie passed")
 				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
 
-			logger.Info("got token", slog.String("auth", auth[7:]))
-			claims, err := jwt.Decode(auth[7:], jwtSecret)
+			claims, err := jwt.Verify[User](token, keys, opts...)
 			if err != nil {
-				logger.Error("failed to parse jwt token", slog.Any("error", err))
+				if errors.Is(err, jwt.ErrTokenExpired) {
+					// access tokens are short-lived, the client is expected to refresh it
+					logger.ErrorContext(r.Context(), "jwt expired", slog.Any("error", err))
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				}
+				logger.ErrorContext(r.Context(), "failed to parse jwt token", slog.Any("error", err))
 				http.Redirect(w, r, "/login", http.StatusFound)
 				return
 			}
 
-			ttl := int64(claims["ttl"].(float64))
-			if ttl < clock.Now().Unix() {
-				logger.Error("jwt expired", slog.Int64("ttl", ttl))
-				http.Redirect(w, r, "/logout", http.StatusFound)
+			user := &claims.Payload
+
+			// tokens without `iat` claim are treated as the oldest ones
+			var issuedAt time.Time
+			if claims.IssuedAt != nil {
+				issuedAt = claims.IssuedAt.Time
+			}
+			revoked, err := revocations.IsRevoked(r.Context(), user.UserID, issuedAt)
+			if err != nil {
+				logger.ErrorContext(r.Context(), "failed to check token revocation", slog.Any("error", err))
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 
-			logger.Info("got valid claims", slog.Any("claims", claims))
+			if revoked {
+				logger.ErrorContext(r.Context(), "jwt revoked", slog.Int64("user_id", user.UserID))
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			logger.DebugContext(r.Context(), "got valid claims", slog.Int64("user_id", user.UserID), slog.String("jti", claims.ID))
 
-			ctx := context.WithValue(r.Context(), contextKey, claims["payload"])
+			ctx := context.WithValue(r.Context(), contextKey, user)
 			next.ServeHTTP(w, r.WithContext(ctx))
 		})
 	}
 }
 
+func tokenFromRequest(r *http.Request) (string, bool) {
+	if auth := r.Header.Get("Authorization"); len(auth) > 0 {
+		if len(auth) < 7 {
+			return "", false
+		}
+		return auth[7:], true
+	}
+
+	if cookie, err := r.Cookie(AuthCookie); err == nil && len(cookie.Value) > 0 {
+		return cookie.Value, true
+	}
+	return "", false
+}
+
 func HeaderAuth(header, token string, logger *slog.Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			if r.Header.Get(header) != token {
-				logger.Warn("attempt of unauthenticated access", slog.Any("headers", r.Header))
+			if subtle.ConstantTimeCompare([]byte(r.Header.Get(header)), []byte(token)) != 1 {
+				logger.WarnContext(r.Context(), "attempt of unauthenticated access",
+					slog.String("remoteAddr", r.RemoteAddr),
+					slog.String("path", r.URL.Path),
+				)
 				http.Error(w, "Forbidden", http.StatusForbidden)
 			} else {
 				next.ServeHTTP(w, r)
@@ -56,26 +105,20 @@ func HeaderAuth(header, token string, logger *slog.Logger) Middleware {
 	}
 }
 
-func RoleAuth(role string, logger *slog.Logger) Middleware {
+func RequirePermission(p permission.Permission, logger *slog.Logger) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			dict, ok := r.Context().Value(User{}).(map[string]interface{})
-			if !ok {
-				logger.Error("failed to read user dictionary from context", slog.Any("value", r.Context().Value(User{})))
-				http.Error(w, "Bad Request", http.StatusBadRequest)
-				return
-			}
-
-			user, err := DecodeUser(dict)
+			user, err := UserFromContext(r.Context())
 			if err != nil {
-				logger.Error("failed to decode user from dictionary", slog.Any("value", dict), slog.Any("error", err))
+				logger.ErrorContext(r.Context(), "failed to read user from context", slog.Any("error", err))
 				http.Error(w, "Bad Request", http.StatusBadRequest)
 				return
 			}
 
-			if user.Role != role {
-				logger.Error("unauthorized access", slog.Any("user", user))
-				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			// the user is authenticated, so a new token would not help, unlike `401`
+			if !permission.Has(user.Role, p) {
+				logger.WarnContext(r.Context(), "permission denied", slog.Any("user", user), slog.String("permission", string(p)))
+				http.Error(w, "Forbidden", http.StatusForbidden)
 				return
 			}
 			next.ServeHTTP(w, r)
@@ -91,39 +134,11 @@ type User struct {
 	Role      string `json:"role"`
 }
 
-func DecodeUser(dict map[string]interface{}) (*User, error) {
-	var user = &User{}
-
-	// FIXME: claims type mapping
-	if v, ok := dict["user_id"].(float64); ok {
-		user.UserID = int64(v)
-	} else {
-		return nil, fmt.Errorf("failed to parse UserID")
-	}
-
-	if v, ok := dict["first_name"].(string); ok {
-		user.FirstName = v
-	} else {
-		return nil, fmt.Errorf("failed to parse FirstName")
-	}
-
-	if v, ok := dict["last_name"].(string); ok {
-		user.LastName = v
-	} else {
-		return nil, fmt.Errorf("failed to parse LastName")
-	}
-
-	if v, ok := dict["username"].(string); ok {
-		user.Username = v
-	} else {
-		return nil, fmt.Errorf("failed to parse Username")
-	}
-
-	if v, ok := dict["role"].(string); ok {
-		user.Role = v
-	} else {
-		return nil, fmt.Errorf("failed to parse Role")
+// UserFromContext returns the user stored in the request context by `JwtAuth`.
+func UserFromContext(ctx context.Context) (*User, error) {
+	user, ok := ctx.Value(User{}).(*User)
+	if !ok {
+		return nil, fmt.Errorf("unexpected user value in context: %v", ctx.Value(User{}))
 	}
-
 	return user, nil
 }
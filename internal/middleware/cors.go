@@ -0,0 +1,78 @@
+package middleware
+
+import (
+	"log/slog"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSPolicy lets other origins call the API, e.g. a dashboard hosted elsewhere
+type CORSPolicy struct {
+	// AllowedOrigins are matched exactly, `*` allows any origin unless credentials are allowed
+	AllowedOrigins []string
+	// AllowCredentials lets browsers send the session cookies, they are `SameSite=Strict`,
+	// so only origins of the same site get them, e.g. sibling subdomains
+	AllowCredentials bool
+	// MaxAge lets browsers cache the preflight response
+	MaxAge time.Duration
+}
+
+var (
+	corsMethods = strings.Join([]string{http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodDelete}, ", ")
+	corsHeaders = strings.Join([]string{"Authorization", "Content-Type", CSRFHeader, RequestIDHeader}, ", ")
+)
+
+// CORS answers preflight requests of the allowed origins and sets `Access-Control-*` headers on their requests,
+// requests of other origins are served without them, so browsers do not expose the responses
+func CORS(policy CORSPolicy, logger *slog.Logger) Middleware {
+	allowed := func(origin string) bool {
+		if slices.Contains(policy.AllowedOrigins, origin) {
+			return true
+		}
+		return !policy.AllowCredentials && slices.Contains(policy.AllowedOrigins, "*")
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if len(origin) == 0 {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Add("Vary", "Origin")
+			preflight := r.Method == http.MethodOptions && len(r.Header.Get("Access-Control-Request-Method")) > 0
+
+			if !allowed(origin) {
+				if preflight {
+					logger.WarnContext(r.Context(), "cors origin not allowed", slog.String("origin", origin), slog.String("path", r.URL.Path))
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Origin", origin)
+			if policy.AllowCredentials {
+				w.Header().Set("Access-Control-Allow-Credentials", "true")
+			}
+
+			if !preflight {
+				w.Header().Set("Access-Control-Expose-Headers", RequestIDHeader)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			w.Header().Set("Access-Control-Allow-Methods", corsMethods)
+			w.Header().Set("Access-Control-Allow-Headers", corsHeaders)
+			if policy.MaxAge > 0 {
+				w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(policy.MaxAge.Seconds())))
+			}
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+}
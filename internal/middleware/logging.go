@@ -28,7 +28,15 @@ func Logging(logger *slog.Logger) Middleware {
 
 			next.ServeHTTP(wrapped, r)
 
-			logger.Info(
+			level := slog.LevelInfo
+			switch {
+			case wrapped.statusCode >= 500:
+				level = slog.LevelError
+			case wrapped.statusCode >= 400:
+				level = slog.LevelWarn
+			}
+
+			logger.Log(r.Context(), level,
 				"handled request",
 				slog.Int("statusCode", wrapped.statusCode),
 				slog.String("remoteAddr", r.RemoteAddr),
@@ -0,0 +1,40 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestObserver records handled requests, see `metrics.Metrics`
+type RequestObserver interface {
+	ObserveRequest(method, route string, status int, duration time.Duration)
+}
+
+// Metrics reports every request by the `http.ServeMux` pattern it matched,
+// so path parameters do not blow up metrics cardinality
+func Metrics(observer RequestObserver) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+
+			wrapped := &wrappedWriter{
+				ResponseWriter: w,
+				statusCode:     http.StatusOK,
+			}
+
+			next.ServeHTTP(wrapped, r)
+
+			// the router sets the pattern on the request it was given, method is a label on its own
+			route := r.Pattern
+			if i := strings.IndexByte(route, ' '); i >= 0 {
+				route = route[i+1:]
+			}
+			if len(route) == 0 {
+				route = "unmatched"
+			}
+
+			observer.ObserveRequest(r.Method, route, wrapped.statusCode, time.Since(start))
+		})
+	}
+}
@@ -0,0 +1,74 @@
+package middleware
+
+import (
+	"log/slog"
+	"math"
+	"net"
+	"net/http"
+	"net/netip"
+	"strconv"
+	"strings"
+
+	"github.com/ailinykh/waitlist/internal/ratelimit"
+)
+
+// RateLimit limits requests per authenticated user, falling back to the client IP for anonymous requests.
+// Place it after `JwtAuth` to key requests by user.
+func RateLimit(limiter *ratelimit.Limiter, trustedProxies []netip.Prefix, logger *slog.Logger) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key := "ip:" + ClientIP(r, trustedProxies)
+			if user, err := UserFromContext(r.Context()); err == nil {
+				key = "user:" + strconv.FormatInt(user.UserID, 10)
+			}
+
+			if ok, wait := limiter.Allow(key); !ok {
+				logger.WarnContext(r.Context(), "rate limit exceeded", slog.String("key", key), slog.String("path", r.URL.Path))
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+				http.Error(w, "Too Many Requests", http.StatusTooManyRequests)
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// ClientIP returns the remote address unless the request came through trusted proxies.
+// In that case `X-Forwarded-For` is walked from the right, and the first untrusted address is the client.
+func ClientIP(r *http.Request, trustedProxies []netip.Prefix) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil || !trusted(addr, trustedProxies) {
+		return host
+	}
+
+	hops := strings.Split(strings.Join(r.Header.Values("X-Forwarded-For"), ","), ",")
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := strings.TrimSpace(hops[i])
+		addr, err := netip.ParseAddr(hop)
+		if err != nil {
+			break
+		}
+
+		if !trusted(addr, trustedProxies) {
+			return hop
+		}
+		host = hop
+	}
+	return host
+}
+
+func trusted(addr netip.Addr, prefixes []netip.Prefix) bool {
+	addr = addr.Unmap()
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,29 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+
+	"github.com/ailinykh/waitlist/internal/logging"
+	"github.com/google/uuid"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+var requestIDRegexp = regexp.MustCompile(`^[\w.-]{1,128}$`)
+
+// RequestID propagates `X-Request-ID` passed by a proxy or generates a new one,
+// the id is put into the request context for logging and echoed back in the response
+func RequestID() Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			id := r.Header.Get(RequestIDHeader)
+			if !requestIDRegexp.MatchString(id) {
+				id = uuid.NewString()
+			}
+
+			w.Header().Set(RequestIDHeader, id)
+			next.ServeHTTP(w, r.WithContext(logging.WithRequestID(r.Context(), id)))
+		})
+	}
+}
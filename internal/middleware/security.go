@@ -0,0 +1,59 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// SecurityPolicy lists the security headers set on every response, empty values are not sent
+type SecurityPolicy struct {
+	ContentSecurityPolicy string
+	// HSTSMaxAge tells browsers to only use HTTPS for the domain, browsers ignore it on plain HTTP responses
+	HSTSMaxAge     time.Duration
+	FrameOptions   string
+	ReferrerPolicy string
+}
+
+// DefaultSecurityPolicy allows the Telegram Login Widget script and its iframe. The SPA navigates to `/login`
+// without reloading the document, so the policy of the page loaded first has to allow the widget.
+// Telegram Web embeds Mini Apps in an iframe, browsers supporting `frame-ancestors` ignore `X-Frame-Options`.
+func DefaultSecurityPolicy() SecurityPolicy {
+	return SecurityPolicy{
+		ContentSecurityPolicy: "default-src 'self'; " +
+			// the prerendered pages boot with inline scripts
+			"script-src 'self' 'unsafe-inline' https://telegram.org; " +
+			"style-src 'self' 'unsafe-inline'; " +
+			"img-src 'self' data: https://t.me https://*.telegram.org; " +
+			"frame-src https://oauth.telegram.org; " +
+			"connect-src 'self'; " +
+			"frame-ancestors 'self' https://web.telegram.org; " +
+			"object-src 'none'; base-uri 'self'; form-action 'self'",
+		HSTSMaxAge:     time.Hour * 24 * 365,
+		FrameOptions:   "DENY",
+		ReferrerPolicy: "strict-origin-when-cross-origin",
+	}
+}
+
+func SecurityHeaders(policy SecurityPolicy) Middleware {
+	headers := map[string]string{
+		"X-Content-Type-Options":  "nosniff",
+		"Content-Security-Policy": policy.ContentSecurityPolicy,
+		"X-Frame-Options":         policy.FrameOptions,
+		"Referrer-Policy":         policy.ReferrerPolicy,
+	}
+	if policy.HSTSMaxAge > 0 {
+		headers["Strict-Transport-Security"] = fmt.Sprintf("max-age=%d; includeSubDomains", int64(policy.HSTSMaxAge.Seconds()))
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for key, value := range headers {
+				if len(value) > 0 {
+					w.Header().Set(key, value)
+				}
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -2,23 +2,36 @@ package middleware
 
 import (
 	"net/http"
+	"path"
+	"strconv"
 	"strings"
 )
 
+// ImmutablePrefix is where SvelteKit puts the assets having a content hash in their names
+const ImmutablePrefix = "/_app/immutable/"
+
 type spaWriter struct {
 	http.ResponseWriter
-	notFound bool
+	cacheControl string
+	wroteHeader  bool
+	notFound     bool
 }
 
 func (w *spaWriter) WriteHeader(statusCode int) {
+	w.wroteHeader = true
 	if statusCode == http.StatusNotFound {
 		w.notFound = true
 	} else {
+		w.Header().Set("Cache-Control", w.cacheControl)
 		w.ResponseWriter.WriteHeader(statusCode)
 	}
 }
 
 func (w *spaWriter) Write(p []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+
 	if w.notFound {
 		return len(p), nil
 	}
@@ -26,10 +39,15 @@ func (w *spaWriter) Write(p []byte) (int, error) {
 	return w.ResponseWriter.Write(p)
 }
 
+// NewSPA lets the `fallback` serve paths not found, so the client side router handles them.
+// Hashed assets are cached for a year, everything else is revalidated to pick up new deployments.
 func NewSPA(fallback http.Handler) Middleware {
 	return func(next http.Handler) http.Handler {
 		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			writer := &spaWriter{ResponseWriter: w}
+			writer := &spaWriter{ResponseWriter: w, cacheControl: "no-cache"}
+			if strings.HasPrefix(r.URL.Path, ImmutablePrefix) {
+				writer.cacheControl = "public, max-age=31536000, immutable"
+			}
 			next.ServeHTTP(writer, r)
 
 			if writer.notFound {
@@ -39,6 +57,26 @@ func NewSPA(fallback http.Handler) Middleware {
 	}
 }
 
+// Precompressed serves `.br` or `.gz` siblings of the files requested when the client accepts them,
+// e.g. the ones written by SvelteKit with `precompress: true`
+func Precompressed(files http.FileSystem) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.Method == http.MethodGet || r.Method == http.MethodHead {
+				name := path.Clean("/" + r.URL.Path)
+				if strings.HasSuffix(r.URL.Path, "/") {
+					name = path.Join(name, "index.html")
+				}
+				if serveCompressed(w, r, files, name) {
+					return
+				}
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
 func ServeFileContents(file string, files http.FileSystem) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		// Restrict only to instances where the browser is looking for an HTML file
@@ -47,12 +85,20 @@ func ServeFileContents(file string, files http.FileSystem) http.HandlerFunc {
 			return
 		}
 
+		// the page refers to the hashed assets of the current build, so it is always revalidated
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-cache")
+		if serveCompressed(w, r, files, "/"+file) {
+			return
+		}
+
 		// Open the file and return its contents using http.ServeContent
 		index, err := files.Open(file)
 		if err != nil {
 			http.Error(w, "Not Found", http.StatusNotFound)
 			return
 		}
+		defer index.Close()
 
 		fi, err := index.Stat()
 		if err != nil {
@@ -60,7 +106,59 @@ func ServeFileContents(file string, files http.FileSystem) http.HandlerFunc {
 			return
 		}
 
-		w.Header().Set("Content-Type", "text/html; charset=utf-8")
 		http.ServeContent(w, r, fi.Name(), fi.ModTime(), index)
 	}
 }
+
+// encodings are listed in order of preference
+var encodings = []struct {
+	name string
+	ext  string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+func serveCompressed(w http.ResponseWriter, r *http.Request, files http.FileSystem, name string) bool {
+	w.Header().Add("Vary", "Accept-Encoding")
+	for _, encoding := range encodings {
+		if !acceptsEncoding(r.Header.Get("Accept-Encoding"), encoding.name) {
+			continue
+		}
+
+		f, err := files.Open(name + encoding.ext)
+		if err != nil {
+			continue
+		}
+		defer f.Close()
+
+		fi, err := f.Stat()
+		if err != nil || fi.IsDir() {
+			continue
+		}
+
+		// the content type is picked by the extension of `name`, not the one of the compressed file
+		w.Header().Set("Content-Encoding", encoding.name)
+		http.ServeContent(w, r, name, fi.ModTime(), f)
+		return true
+	}
+	return false
+}
+
+// acceptsEncoding reports whether `Accept-Encoding` header lists the `encoding` without `q=0`
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		coding, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), encoding) {
+			continue
+		}
+
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
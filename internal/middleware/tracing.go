@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Tracing starts a server span for every request, continuing the trace passed in `traceparent` header.
+// Once routed, the span is renamed after the `http.ServeMux` pattern.
+func Tracing(tp trace.TracerProvider) Middleware {
+	return func(next http.Handler) http.Handler {
+		routed := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(w, r)
+
+			// the router sets the pattern on the request it was given
+			if len(r.Pattern) > 0 {
+				span := trace.SpanFromContext(r.Context())
+				span.SetName(r.Pattern)
+				if _, route, ok := strings.Cut(r.Pattern, " "); ok {
+					span.SetAttributes(semconv.HTTPRoute(route))
+				}
+			}
+		})
+
+		return otelhttp.NewHandler(routed, "http.request",
+			otelhttp.WithTracerProvider(tp),
+			otelhttp.WithPropagators(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{})),
+		)
+	}
+}
@@ -0,0 +1,38 @@
+package permission
+
+import "slices"
+
+type Permission string
+
+const (
+	// ReadEntries allows to read waitlist entries of the bots assigned to the user
+	ReadEntries Permission = "entries:read"
+	// ManageUsers allows to list users, change their roles and deactivate accounts
+	ManageUsers Permission = "users:manage"
+	// ManageBots allows to assign bots to users
+	ManageBots Permission = "bots:manage"
+	// AllBots lifts per-bot scoping, so every bot is visible to the user
+	AllBots Permission = "bots:all"
+)
+
+const (
+	RoleUser   = "user"
+	RoleViewer = "viewer"
+	RoleAdmin  = "admin"
+)
+
+var roles = map[string][]Permission{
+	RoleUser:   {},
+	RoleViewer: {ReadEntries},
+	RoleAdmin:  {ReadEntries, ManageUsers, ManageBots, AllBots},
+}
+
+// Roles returns all known role names
+func Roles() []string {
+	return []string{RoleUser, RoleViewer, RoleAdmin}
+}
+
+// Has reports whether the role grants the permission
+func Has(role string, permission Permission) bool {
+	return slices.Contains(roles[role], permission)
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/clock"
+)
+
+// Limiter is a token bucket per key. Every bucket holds up to `burst` tokens
+// and gets refilled with `rate` tokens per second. Buckets live in memory, so behind a load balancer
+// a client gets up to `rate` times the number of replicas.
+type Limiter struct {
+	clock     clock.Clock
+	rate      float64
+	burst     float64
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastPrune time.Time
+}
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+}
+
+func New(rate float64, burst int, clock clock.Clock) *Limiter {
+	return &Limiter{
+		clock:   clock,
+		rate:    rate,
+		burst:   float64(burst),
+		buckets: make(map[string]*bucket),
+	}
+}
+
+// Allow takes a token from the bucket of the key, otherwise it reports how long to wait for the next one
+func (l *Limiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	l.prune(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{tokens: l.burst, updatedAt: now}
+		l.buckets[key] = b
+	}
+
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate)
+	b.updatedAt = now
+
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+
+	if l.rate <= 0 {
+		// the bucket is never refilled
+		return false, 0
+	}
+
+	wait := time.Duration((1 - b.tokens) / l.rate * float64(time.Second))
+	return false, wait
+}
+
+// prune drops the buckets refilled up to `burst` once a minute, they are no different from the new ones
+func (l *Limiter) prune(now time.Time) {
+	if now.Sub(l.lastPrune) < time.Minute {
+		return
+	}
+	l.lastPrune = now
+
+	for key, b := range l.buckets {
+		if b.tokens+now.Sub(b.updatedAt).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,50 @@
+package ratelimit_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/ratelimit"
+)
+
+func TestLimiter(t *testing.T) {
+	clock := clock.NewFake(time.Date(2013, 8, 14, 22, 0, 0, 0, time.UTC))
+	limiter := ratelimit.New(0.5, 2, clock)
+
+	t.Run("it allows burst", func(t *testing.T) {
+		for i := 0; i < 2; i++ {
+			if ok, _ := limiter.Allow("cat"); !ok {
+				t.Fatalf("expected request %d to be allowed", i)
+			}
+		}
+	})
+
+	t.Run("it limits requests over burst", func(t *testing.T) {
+		ok, wait := limiter.Allow("cat")
+		if ok {
+			t.Fatal("expected request to be limited")
+		}
+
+		if wait != time.Second*2 {
+			t.Errorf("expected to wait 2s, got %s", wait)
+		}
+	})
+
+	t.Run("it keeps buckets per key", func(t *testing.T) {
+		if ok, _ := limiter.Allow("dog"); !ok {
+			t.Error("expected request to be allowed")
+		}
+	})
+
+	t.Run("it refills bucket over time", func(t *testing.T) {
+		clock.Add(time.Second * 2)
+		if ok, _ := limiter.Allow("cat"); !ok {
+			t.Error("expected request to be allowed")
+		}
+
+		if ok, _ := limiter.Allow("cat"); ok {
+			t.Error("expected request to be limited")
+		}
+	})
+}
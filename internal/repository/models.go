@@ -5,11 +5,48 @@
 package repository
 
 import (
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
 )
 
+type BannedWord struct {
+	BotUsername string    `json:"bot_username"`
+	Word        string    `json:"word"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type BlockedUser struct {
+	UserID    int64     `json:"user_id"`
+	Reason    string    `json:"reason"`
+	BlockedBy int64     `json:"blocked_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type LoginPayload struct {
+	Hash      string    `json:"hash"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type RefreshToken struct {
+	ID        uuid.UUID    `json:"id"`
+	UserID    int64        `json:"user_id"`
+	TokenHash string       `json:"token_hash"`
+	ExpiresAt time.Time    `json:"expires_at"`
+	RevokedAt sql.NullTime `json:"revoked_at"`
+	CreatedAt time.Time    `json:"created_at"`
+}
+
+type RoleChange struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    int64     `json:"user_id"`
+	OldRole   string    `json:"old_role"`
+	NewRole   string    `json:"new_role"`
+	ChangedBy int64     `json:"changed_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
 type User struct {
 	ID        uuid.UUID `json:"id"`
 	UserID    int64     `json:"user_id"`
@@ -20,9 +57,34 @@ type User struct {
 	Role      string    `json:"role"`
 	CreatedAt time.Time `json:"created_at"`
 	UpdatedAt time.Time `json:"updated_at"`
+	Active    bool      `json:"active"`
+}
+
+type UserBot struct {
+	UserID      int64     `json:"user_id"`
+	BotUsername string    `json:"bot_username"`
+	CreatedAt   time.Time `json:"created_at"`
+}
+
+type TokenRevocation struct {
+	ID        uuid.UUID `json:"id"`
+	UserID    int64     `json:"user_id"`
+	RevokedAt time.Time `json:"revoked_at"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type Waitlist struct {
+	ID          uuid.UUID `json:"id"`
+	UserID      int64     `json:"user_id"`
+	BotUsername string    `json:"bot_username"`
+	Message     string    `json:"message"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Flagged     bool      `json:"flagged"`
+	FlagReason  string    `json:"flag_reason"`
+}
+
+type WaitlistEntry struct {
 	ID          uuid.UUID `json:"id"`
 	UserID      int64     `json:"user_id"`
 	FirstName   string    `json:"first_name"`
@@ -32,4 +94,6 @@ type Waitlist struct {
 	Message     string    `json:"message"`
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
+	Flagged     bool      `json:"flagged"`
+	FlagReason  string    `json:"flag_reason"`
 }
@@ -0,0 +1,47 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+)
+
+// TxDB is a DBTX able to start transactions, e.g. `*sql.DB`
+type TxDB interface {
+	DBTX
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
+}
+
+// TxWrapper is implemented by DBTX decorators, so the queries run in a transaction stay decorated
+type TxWrapper interface {
+	WrapTx(tx *sql.Tx) DBTX
+}
+
+// InTx runs `fn` with the queries bound to a single transaction, committed once `fn` succeeds and rolled back otherwise.
+// Queries already bound to a transaction run `fn` in it.
+func (q *Queries) InTx(ctx context.Context, fn func(*Queries) error) error {
+	if _, ok := q.db.(*sql.Tx); ok {
+		return fn(q)
+	}
+
+	db, ok := q.db.(TxDB)
+	if !ok {
+		return fmt.Errorf("%T does not support transactions", q.db)
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+
+	var txdb DBTX = tx
+	if w, ok := q.db.(TxWrapper); ok {
+		txdb = w.WrapTx(tx)
+	}
+
+	if err := fn(New(txdb)); err != nil {
+		return errors.Join(err, tx.Rollback())
+	}
+	return tx.Commit()
+}
@@ -10,69 +10,45 @@ import (
 	"database/sql"
 
 	"github.com/google/uuid"
+	"github.com/lib/pq"
 )
 
 const createEntry = `-- name: CreateEntry :execresult
-INSERT INTO waitlist (user_id, first_name, last_name, username, bot_username, message)
-VALUES ($1, $2, $3, $4, $5, $6)
+INSERT INTO waitlist (user_id, bot_username, message, flagged, flag_reason)
+VALUES ($1, $2, $3, $4, $5)
 `
 
 type CreateEntryParams struct {
 	UserID      int64  `json:"user_id"`
-	FirstName   string `json:"first_name"`
-	LastName    string `json:"last_name"`
-	Username    string `json:"username"`
 	BotUsername string `json:"bot_username"`
 	Message     string `json:"message"`
+	Flagged     bool   `json:"flagged"`
+	FlagReason  string `json:"flag_reason"`
 }
 
 func (q *Queries) CreateEntry(ctx context.Context, arg CreateEntryParams) (sql.Result, error) {
 	return q.db.ExecContext(ctx, createEntry,
 		arg.UserID,
-		arg.FirstName,
-		arg.LastName,
-		arg.Username,
 		arg.BotUsername,
 		arg.Message,
-	)
-}
-
-const createUser = `-- name: CreateUser :execresult
-INSERT INTO users (user_id, first_name, last_name, username, photo_url, role)
-VALUES ($1, $2, $3, $4, $5, 'user')
-`
-
-type CreateUserParams struct {
-	UserID    int64  `json:"user_id"`
-	FirstName string `json:"first_name"`
-	LastName  string `json:"last_name"`
-	Username  string `json:"username"`
-	PhotoUrl  string `json:"photo_url"`
-}
-
-func (q *Queries) CreateUser(ctx context.Context, arg CreateUserParams) (sql.Result, error) {
-	return q.db.ExecContext(ctx, createUser,
-		arg.UserID,
-		arg.FirstName,
-		arg.LastName,
-		arg.Username,
-		arg.PhotoUrl,
+		arg.Flagged,
+		arg.FlagReason,
 	)
 }
 
 const getAllEntries = `-- name: GetAllEntries :many
-SELECT id, user_id, first_name, last_name, username, bot_username, message, created_at, updated_at FROM waitlist
+SELECT id, user_id, first_name, last_name, username, bot_username, message, created_at, updated_at, flagged, flag_reason FROM waitlist_entries
 `
 
-func (q *Queries) GetAllEntries(ctx context.Context) ([]Waitlist, error) {
+func (q *Queries) GetAllEntries(ctx context.Context) ([]WaitlistEntry, error) {
 	rows, err := q.db.QueryContext(ctx, getAllEntries)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
-	var items []Waitlist
+	var items []WaitlistEntry
 	for rows.Next() {
-		var i Waitlist
+		var i WaitlistEntry
 		if err := rows.Scan(
 			&i.ID,
 			&i.UserID,
@@ -83,6 +59,8 @@ func (q *Queries) GetAllEntries(ctx context.Context) ([]Waitlist, error) {
 			&i.Message,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Flagged,
+			&i.FlagReason,
 		); err != nil {
 			return nil, err
 		}
@@ -98,7 +76,7 @@ func (q *Queries) GetAllEntries(ctx context.Context) ([]Waitlist, error) {
 }
 
 const getAllUsers = `-- name: GetAllUsers :many
-SELECT id, user_id, first_name, last_name, username, photo_url, role, created_at, updated_at FROM users
+SELECT id, user_id, first_name, last_name, username, photo_url, role, created_at, updated_at, active FROM users
 `
 
 func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
@@ -120,6 +98,85 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 			&i.Role,
 			&i.CreatedAt,
 			&i.UpdatedAt,
+			&i.Active,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEntriesByBotUsernames = `-- name: GetEntriesByBotUsernames :many
+SELECT id, user_id, first_name, last_name, username, bot_username, message, created_at, updated_at, flagged, flag_reason FROM waitlist_entries WHERE bot_username = ANY($1::text[])
+`
+
+func (q *Queries) GetEntriesByBotUsernames(ctx context.Context, botUsernames []string) ([]WaitlistEntry, error) {
+	rows, err := q.db.QueryContext(ctx, getEntriesByBotUsernames, pq.Array(botUsernames))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WaitlistEntry
+	for rows.Next() {
+		var i WaitlistEntry
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Username,
+			&i.BotUsername,
+			&i.Message,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Flagged,
+			&i.FlagReason,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getEntriesByUserID = `-- name: GetEntriesByUserID :many
+SELECT id, user_id, first_name, last_name, username, bot_username, message, created_at, updated_at, flagged, flag_reason FROM waitlist_entries WHERE user_id = $1
+`
+
+func (q *Queries) GetEntriesByUserID(ctx context.Context, userID int64) ([]WaitlistEntry, error) {
+	rows, err := q.db.QueryContext(ctx, getEntriesByUserID, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []WaitlistEntry
+	for rows.Next() {
+		var i WaitlistEntry
+		if err := rows.Scan(
+			&i.ID,
+			&i.UserID,
+			&i.FirstName,
+			&i.LastName,
+			&i.Username,
+			&i.BotUsername,
+			&i.Message,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Flagged,
+			&i.FlagReason,
 		); err != nil {
 			return nil, err
 		}
@@ -135,12 +192,12 @@ func (q *Queries) GetAllUsers(ctx context.Context) ([]User, error) {
 }
 
 const getEntryByID = `-- name: GetEntryByID :one
-SELECT id, user_id, first_name, last_name, username, bot_username, message, created_at, updated_at FROM waitlist WHERE id = $1
+SELECT id, user_id, first_name, last_name, username, bot_username, message, created_at, updated_at, flagged, flag_reason FROM waitlist_entries WHERE id = $1
 `
 
-func (q *Queries) GetEntryByID(ctx context.Context, id uuid.UUID) (Waitlist, error) {
+func (q *Queries) GetEntryByID(ctx context.Context, id uuid.UUID) (WaitlistEntry, error) {
 	row := q.db.QueryRowContext(ctx, getEntryByID, id)
-	var i Waitlist
+	var i WaitlistEntry
 	err := row.Scan(
 		&i.ID,
 		&i.UserID,
@@ -151,12 +208,14 @@ func (q *Queries) GetEntryByID(ctx context.Context, id uuid.UUID) (Waitlist, err
 		&i.Message,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Flagged,
+		&i.FlagReason,
 	)
 	return i, err
 }
 
 const getUserByUserID = `-- name: GetUserByUserID :one
-SELECT id, user_id, first_name, last_name, username, photo_url, role, created_at, updated_at FROM users WHERE user_id = $1
+SELECT id, user_id, first_name, last_name, username, photo_url, role, created_at, updated_at, active FROM users WHERE user_id = $1
 `
 
 func (q *Queries) GetUserByUserID(ctx context.Context, userID int64) (User, error) {
@@ -172,6 +231,7 @@ func (q *Queries) GetUserByUserID(ctx context.Context, userID int64) (User, erro
 		&i.Role,
 		&i.CreatedAt,
 		&i.UpdatedAt,
+		&i.Active,
 	)
 	return i, err
 }
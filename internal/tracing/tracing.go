@@ -0,0 +1,131 @@
+package tracing
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ailinykh/waitlist/internal/repository"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Name is the instrumentation scope of the app tracers
+const Name = "github.com/ailinykh/waitlist"
+
+// New creates a provider exporting spans over OTLP/HTTP, the exporter is configured with the standard
+// `OTEL_EXPORTER_OTLP_*` variables. Nothing is sampled unless an endpoint is set.
+func New(ctx context.Context, service string) (*sdktrace.TracerProvider, error) {
+	if len(os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT")) == 0 && len(os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT")) == 0 {
+		return sdktrace.NewTracerProvider(sdktrace.WithSampler(sdktrace.NeverSample())), nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceName(service))),
+	), nil
+}
+
+// Fail marks the span failed, it is a no-op for nil errors
+func Fail(span trace.Span, err error) {
+	if err == nil {
+		return
+	}
+	span.RecordError(err)
+	span.SetStatus(codes.Error, err.Error())
+}
+
+// WrapDB starts a span for every repository query, named after the sqlc `-- name:` annotation
+func WrapDB(db repository.DBTX, tp trace.TracerProvider) repository.DBTX {
+	return &tracedDB{db, tp.Tracer(Name)}
+}
+
+type tracedDB struct {
+	db     repository.DBTX
+	tracer trace.Tracer
+}
+
+func (t *tracedDB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	res, err := t.db.ExecContext(ctx, query, args...)
+	Fail(span, err)
+	return res, err
+}
+
+func (t *tracedDB) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	stmt, err := t.db.PrepareContext(ctx, query)
+	Fail(span, err)
+	return stmt, err
+}
+
+func (t *tracedDB) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	rows, err := t.db.QueryContext(ctx, query, args...)
+	Fail(span, err)
+	return rows, err
+}
+
+func (t *tracedDB) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	ctx, span := t.start(ctx, query)
+	defer span.End()
+
+	row := t.db.QueryRowContext(ctx, query, args...)
+	// the error of a single row query is only known on scan, missing rows are expected anyway
+	if err := row.Err(); !errors.Is(err, sql.ErrNoRows) {
+		Fail(span, err)
+	}
+	return row
+}
+
+func (t *tracedDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	db, ok := t.db.(repository.TxDB)
+	if !ok {
+		return nil, fmt.Errorf("%T does not support transactions", t.db)
+	}
+	return db.BeginTx(ctx, opts)
+}
+
+// WrapTx keeps tracing the queries run in a transaction
+func (t *tracedDB) WrapTx(tx *sql.Tx) repository.DBTX {
+	return &tracedDB{tx, t.tracer}
+}
+
+func (t *tracedDB) start(ctx context.Context, query string) (context.Context, trace.Span) {
+	name := queryName(query)
+	return t.tracer.Start(ctx, "db."+name,
+		trace.WithSpanKind(trace.SpanKindClient),
+		trace.WithAttributes(
+			semconv.DBSystemPostgreSQL,
+			attribute.String("db.operation.name", name),
+		),
+	)
+}
+
+// queryName extracts `GetAllEntries` from `-- name: GetAllEntries :many`
+func queryName(query string) string {
+	line, _, _ := strings.Cut(query, "\n")
+	if fields := strings.Fields(line); len(fields) >= 3 && fields[0] == "--" && fields[1] == "name:" {
+		return fields[2]
+	}
+	return "query"
+}
@@ -0,0 +1,90 @@
+package tracing_test
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"testing"
+
+	"github.com/ailinykh/waitlist/internal/tracing"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+type fakeDB struct {
+	err error
+}
+
+func (db *fakeDB) ExecContext(context.Context, string, ...interface{}) (sql.Result, error) {
+	return nil, db.err
+}
+
+func (db *fakeDB) PrepareContext(context.Context, string) (*sql.Stmt, error) {
+	return nil, db.err
+}
+
+func (db *fakeDB) QueryContext(context.Context, string, ...interface{}) (*sql.Rows, error) {
+	return nil, db.err
+}
+
+func (db *fakeDB) QueryRowContext(context.Context, string, ...interface{}) *sql.Row {
+	return nil
+}
+
+func TestWrapDB(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(sdktrace.WithSyncer(exporter))
+	failure := errors.New("connection refused")
+
+	t.Run("it names spans after sqlc queries", func(t *testing.T) {
+		exporter.Reset()
+		db := tracing.WrapDB(&fakeDB{}, tp)
+
+		ctx, parent := tp.Tracer("test").Start(t.Context(), "parent")
+		if _, err := db.ExecContext(ctx, "-- name: CreateEntry :execresult\nINSERT INTO waitlist VALUES ($1)", 1); err != nil {
+			t.Fatal(err)
+		}
+		parent.End()
+
+		spans := exporter.GetSpans()
+		if len(spans) != 2 {
+			t.Fatalf("expected 2 spans, got %d", len(spans))
+		}
+
+		if spans[0].Name != "db.CreateEntry" {
+			t.Errorf("expected span name %q, got %q", "db.CreateEntry", spans[0].Name)
+		}
+
+		if spans[0].Parent.SpanID() != spans[1].SpanContext.SpanID() {
+			t.Errorf("expected query span to be a child of the caller span")
+		}
+	})
+
+	t.Run("it falls back to generic name", func(t *testing.T) {
+		exporter.Reset()
+		db := tracing.WrapDB(&fakeDB{}, tp)
+
+		if _, err := db.ExecContext(t.Context(), "SELECT 1"); err != nil {
+			t.Fatal(err)
+		}
+
+		if name := exporter.GetSpans()[0].Name; name != "db.query" {
+			t.Errorf("expected span name %q, got %q", "db.query", name)
+		}
+	})
+
+	t.Run("it records errors", func(t *testing.T) {
+		exporter.Reset()
+		db := tracing.WrapDB(&fakeDB{err: failure}, tp)
+
+		if _, err := db.QueryContext(t.Context(), "-- name: GetAllEntries :many\nSELECT 1"); !errors.Is(err, failure) {
+			t.Fatalf("expected %v, got %v", failure, err)
+		}
+
+		span := exporter.GetSpans()[0]
+		if span.Status.Code != codes.Error {
+			t.Errorf("expected error status, got %v", span.Status)
+		}
+	})
+}
@@ -4,109 +4,387 @@ import (
 	"context"
 	"database/sql"
 	"embed"
+	"errors"
+	"flag"
+	"fmt"
 	"log/slog"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
-	"sync"
+	"syscall"
+	"time"
 
 	"github.com/ailinykh/waitlist/internal/api/telegram"
 	"github.com/ailinykh/waitlist/internal/app"
+	"github.com/ailinykh/waitlist/internal/clock"
+	"github.com/ailinykh/waitlist/internal/config"
 	"github.com/ailinykh/waitlist/internal/database"
+	"github.com/ailinykh/waitlist/internal/health"
+	"github.com/ailinykh/waitlist/internal/lifecycle"
+	"github.com/ailinykh/waitlist/internal/logging"
+	"github.com/ailinykh/waitlist/internal/metrics"
+	"github.com/ailinykh/waitlist/internal/middleware"
+	"github.com/ailinykh/waitlist/internal/ratelimit"
 	"github.com/ailinykh/waitlist/internal/repository"
+	"github.com/ailinykh/waitlist/internal/tracing"
+	"github.com/ailinykh/waitlist/pkg/jwt"
+	"github.com/ailinykh/waitlist/web"
 )
 
+const usage = `usage: waitlist [command] [flags]
+
+commands:
+  serve                         run the HTTP API
+  bots run                      poll the waitlist bots
+  users promote <telegram_id>   change the user role, see -role
+  entries export                print the waitlist as CSV or JSON
+  token issue <telegram_id>     print an access token for scripts
+  migrate <command>             manage the database schema
+
+The HTTP API and/or the bots run according to -mode when no command is given.
+Run 'waitlist <command> -h' for the flags.`
+
+// commands are looked up by the leading one or two arguments, e.g. `migrate` or `bots run`
+var commands = map[string]func(args []string) int{
+	"serve":          func(args []string) int { return serve(args, config.ModeAPI) },
+	"bots run":       func(args []string) int { return serve(args, config.ModeBots) },
+	"users promote":  promoteCommand,
+	"entries export": exportCommand,
+	"token issue":    tokenCommand,
+	"migrate":        migrateCommand,
+}
+
 func main() {
-	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+	os.Exit(run(os.Args[1:]))
+}
+
+func run(args []string) int {
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		return serve(args, "")
+	}
+
+	for n := 2; n > 0; n-- {
+		if len(args) < n {
+			continue
+		}
+		if command, ok := commands[strings.Join(args[:n], " ")]; ok {
+			return command(args[n:])
+		}
+	}
+
+	fmt.Fprintln(os.Stderr, usage)
+	if args[0] == "help" {
+		return 0
+	}
+	return 2
+}
+
+// serve runs the HTTP API and/or the bots until interrupted, `mode` overrides the configured one
+func serve(args []string, mode string) int {
+	cfg := loadConfig(args, func(c *config.Config) error {
+		if len(mode) > 0 {
+			c.Mode = mode
+		}
+		return c.Validate()
+	})
+	if len(cfg.Args()) > 0 {
+		fmt.Fprintln(os.Stderr, usage)
+		return 2
+	}
+	api := cfg.Mode != config.ModeBots
+	bots := cfg.Mode != config.ModeAPI
+
+	// SIGKILL can not be caught, SIGTERM is what orchestrators send before it
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
 	defer cancel()
 
-	logger := NewLogger()
-	repo := repository.New(db(logger))
+	logger := NewLogger(cfg)
+	logger.Info("loaded config", slog.Any("config", cfg))
 
-	server, err := app.New(
-		logger,
-		repo,
-		app.WithTelegramBotToken(os.Getenv("TELEGRAM_BOT_TOKEN")),
-		app.WithJwtSecret(os.Getenv("JWT_SECRET")),
-	)
+	// components are stopped first, then the hooks in reverse order: the database is closed before traces are flushed
+	lc := lifecycle.New(logger, cfg.ShutdownTimeout)
 
+	tp, err := tracing.New(ctx, "waitlist")
 	if err != nil {
 		panic(err)
 	}
-	var wg sync.WaitGroup
+	lc.OnStop("tracing", tp.Shutdown)
 
-	wg.Go(func() {
-		if err := server.Run(ctx); err != nil {
+	conn, err := db(logger, cfg, cfg.AutoMigrate)
+	if err != nil {
+		panic(err)
+	}
+	lc.OnStop("database", func(context.Context) error {
+		return conn.Close()
+	})
+	repo := repository.New(tracing.WrapDB(conn, tp))
+
+	m := metrics.New()
+	if err := m.RegisterDB(conn, "waitlist"); err != nil {
+		panic(err)
+	}
+
+	tokens := []string{}
+	if bots {
+		tokens = cfg.Bots()
+	}
+
+	clk := clock.New()
+	heartbeats := make([]*health.Heartbeat, len(tokens))
+	for i := range tokens {
+		heartbeats[i] = health.NewHeartbeat(clk)
+	}
+
+	// every bot run in the same process is expected to poll successfully at least once in `BOT_POLL_MAX_AGE`,
+	// or to stand by while another process polls it
+	checks := []func(*app.Config){
+		app.WithReadinessCheck("database", conn.PingContext),
+		app.WithReadinessCheck("migrations", database.Migrated(conn, migrations)),
+	}
+	for i, t := range tokens {
+		checks = append(checks, app.WithReadinessCheck("bot:"+botID(t), heartbeats[i].Check(cfg.BotPollMaxAge)))
+	}
+
+	if api {
+		opts := []func(*app.Config){
+			app.WithPort(cfg.Port),
+			app.WithTimeouts(cfg.ReadTimeout, cfg.WriteTimeout, cfg.IdleTimeout),
+			app.WithHTTPRedirect(cfg.HTTPRedirectPort),
+			app.WithTelegramBotToken(cfg.TelegramBotToken),
+			app.WithJwtSecret(cfg.JwtSecret),
+			app.WithJwtKeys(jwtKeys(cfg)),
+			app.WithAdminTelegramIDs(cfg.AdminTelegramIDs...),
+			app.WithTelegramAuthMaxAge(cfg.TelegramAuthMaxAge),
+			app.WithTrustedProxies(cfg.Proxies()...),
+			app.WithRateLimit(cfg.RateLimit, cfg.RateLimitBurst),
+			app.WithMetrics(m),
+			app.WithMetricsToken(cfg.MetricsToken),
+			app.WithTracerProvider(tp),
+		}
+		opts = append(opts, checks...)
+
+		if cfg.LoginAnyBot {
+			opts = append(opts, app.WithLoginBots(cfg.Bots()...))
+		}
+		for host, bot := range cfg.LoginBotDomains {
+			opts = append(opts, app.WithLoginBotDomain(host, bot))
+		}
+
+		policy := middleware.DefaultSecurityPolicy()
+		if len(cfg.ContentSecurityPolicy) > 0 {
+			policy.ContentSecurityPolicy = cfg.ContentSecurityPolicy
+		}
+		policy.HSTSMaxAge = cfg.HSTSMaxAge
+		policy.FrameOptions = cfg.FrameOptions
+		policy.ReferrerPolicy = cfg.ReferrerPolicy
+		opts = append(opts,
+			app.WithSecurityPolicy(policy),
+			app.WithCORS(middleware.CORSPolicy{
+				AllowedOrigins:   cfg.CORSAllowedOrigins,
+				AllowCredentials: cfg.CORSAllowCredentials,
+				MaxAge:           cfg.CORSMaxAge,
+			}),
+		)
+
+		// the directory is a dev override, e.g. to serve a fresh `npm run build` without recompiling
+		switch {
+		case len(cfg.StaticFilesDir) > 0:
+			opts = append(opts, app.WithStaticFilesDir(cfg.StaticFilesDir))
+		case web.Build != nil:
+			opts = append(opts, app.WithStaticFiles(web.Build))
+		}
+
+		switch {
+		case len(cfg.AutocertDomains) > 0:
+			opts = append(opts, app.WithAutocert(cfg.AutocertCacheDir, cfg.AutocertEmail, cfg.AutocertDomains...))
+		case len(cfg.TLSCertFile) > 0:
+			opts = append(opts, app.WithTLSCertificate(cfg.TLSCertFile, cfg.TLSKeyFile))
+		}
+
+		server, err := app.New(logger, repo, opts...)
+		if err != nil {
 			panic(err)
 		}
-	})
 
-	for _, t := range parseTokens() {
-		wg.Go(func() {
-			bot, err := telegram.NewBot(t, "https://api.telegram.org", logger)
-			if err != nil {
-				logger.Error("failed to create waitlist", "error", err)
-				return
-			}
-
-			waitlist := app.NewWaitlist(bot, repo, logger.With("username", bot.Username))
-
-			for {
-				select {
-				case <-ctx.Done():
-					return
-				default:
-					err = waitlist.Run(ctx)
+		lc.Go("server", server.Run)
+	} else if cfg.MonitoringPort > 0 {
+		// without the API the bots are observed through a listener of their own
+		monitor, err := app.NewMonitor(logger, append(checks,
+			app.WithPort(cfg.MonitoringPort),
+			app.WithTimeouts(cfg.ReadTimeout, cfg.WriteTimeout, cfg.IdleTimeout),
+			app.WithMetrics(m),
+			app.WithMetricsToken(cfg.MetricsToken),
+		)...)
+		if err != nil {
+			panic(err)
+		}
+
+		lc.Go("monitor", monitor.Run)
+	}
+
+	// Telegram only lets one client poll a bot at a time, replicas take turns holding the bot lease.
+	// Every lease holds a connection for as long as the bot runs, so they do not come from the pool the queries use.
+	var leases *sql.DB
+	if len(tokens) > 0 {
+		leases, err = leaseDB(logger, cfg, len(tokens))
+		if err != nil {
+			panic(err)
+		}
+		lc.OnStop("leases", func(context.Context) error {
+			return leases.Close()
+		})
+	}
+
+	for i, t := range tokens {
+		// a failing bot does not take the API and the other bots down, it is retried and readiness reports it meanwhile
+		lease := database.NewLease(leases, "bot:"+botID(t), logger,
+			database.WithLeaseStandby(heartbeats[i].Beat),
+			database.WithLeaseRetry(time.Minute*5),
+		)
+
+		// the waitlist outlives the retries, so its offset does too and handled updates are not delivered again
+		var waitlist *app.Waitlist
+		lc.Go("bot:"+botID(t), func(ctx context.Context) error {
+			return lease.Run(ctx, func(ctx context.Context) error {
+				if waitlist == nil {
+					bot, err := telegram.NewBot(ctx, t, "https://api.telegram.org", logger, telegram.WithTracerProvider(tp))
 					if err != nil {
-						logger.Error("failed to run", "username", bot.Username, "error", err)
-						return
+						return fmt.Errorf("failed to create bot: %w", err)
 					}
+
+					waitlist = app.NewWaitlist(bot, repo, logger.With("username", bot.Username),
+						app.WithBotMetrics(m),
+						app.WithBotTracing(tp),
+						app.WithHeartbeat(heartbeats[i]),
+						app.WithBotClock(clk),
+						app.WithUserRateLimit(ratelimit.New(cfg.BotRateLimit, cfg.BotRateLimitBurst, clk)),
+					)
 				}
-			}
+
+				var err error
+				for ctx.Err() == nil {
+					if err = waitlist.Run(ctx); err != nil && ctx.Err() == nil {
+						err = fmt.Errorf("failed to run bot %s: %w", botID(t), err)
+						break
+					}
+					err = nil
+				}
+
+				// the lease is released while the failure is retried, the next holder starts after the updates handled
+				ctx, cancel := lifecycle.DrainContext(ctx)
+				defer cancel()
+				return errors.Join(err, waitlist.Commit(ctx))
+			})
 		})
 	}
 
-	<-ctx.Done()
-	logger.Info("attempt to shutdown gracefully...")
-
-	wg.Wait()
+	if err := lc.Wait(ctx); err != nil {
+		logger.Error("failed to shutdown gracefully", slog.Any("error", err))
+		return 1
+	}
+	logger.Info("shutdown complete")
+	return 0
 }
 
 //go:embed migrations/*.sql
 var migrations embed.FS
 
-func db(logger *slog.Logger) *sql.DB {
-	db, err := database.New(logger,
-		database.WithURL(os.Getenv("DATABASE_URL")),
-		database.WithMigrations(migrations),
-	)
+// loadConfig exits on invalid config, printing every problem found
+func loadConfig(args []string, validate func(*config.Config) error, flags ...func(*flag.FlagSet)) *config.Config {
+	cfg, err := config.Load(args, os.Environ(), validate, flags...)
+	if errors.Is(err, flag.ErrHelp) {
+		os.Exit(0)
+	}
 	if err != nil {
-		panic(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
-	return db
+	return cfg
 }
 
-func parseTokens() []string {
-	tokens := []string{}
-	for _, env := range os.Environ() {
-		if idx := strings.Index(env, "="); idx > 0 {
-			if strings.HasPrefix(env[:idx], "TELEGRAM_BOT_TOKEN") {
-				tokens = append(tokens, env[idx+1:])
-			}
-		}
+// db connects the database, only `serve` applies the migrations, the other commands expect the schema
+// to be migrated already, see `migrate` command
+func db(logger *slog.Logger, cfg *config.Config, migrate bool) (*sql.DB, error) {
+	opts := []func(*database.Connection){
+		database.WithURL(cfg.DatabaseURL),
+		database.WithPool(cfg.DatabaseMaxOpenConns, cfg.DatabaseMaxIdleConns, cfg.DatabaseConnMaxLifetime, 0),
+		database.WithStatementTimeout(cfg.DatabaseStatementTimeout),
+		database.WithApplicationName("waitlist"),
+		database.WithConnectRetry(cfg.DatabaseConnectTimeout, time.Millisecond*500),
+	}
+	if migrate {
+		opts = append(opts, database.WithMigrations(migrations))
 	}
-	return tokens
+
+	return database.New(logger, opts...)
 }
 
-func NewLogger() *slog.Logger {
-	opts := &slog.HandlerOptions{
-		Level:       slog.LevelDebug,
-		AddSource:   true,
-		ReplaceAttr: replaceAttr,
+// leaseDB opens a connection per lease, they are only used for the advisory locks and live as long as the lease
+func leaseDB(logger *slog.Logger, cfg *config.Config, leases int) (*sql.DB, error) {
+	return database.New(logger,
+		database.WithURL(cfg.DatabaseURL),
+		database.WithPool(leases, leases, 0, 0),
+		database.WithApplicationName("waitlist:leases"),
+		database.WithConnectRetry(cfg.DatabaseConnectTimeout, time.Millisecond*500),
+	)
+}
+
+// botID is the public part of the bot token before the colon, it is safe to expose
+func botID(token string) string {
+	id, _, _ := strings.Cut(token, ":")
+	return id
+}
+
+// jwtKeys builds a keyset from `JWT_SIGNING_KEY` (PEM file with Ed25519 or RSA private key)
+// or `JWT_SECRET`. Previous keys stay valid for verification while listed in
+// `JWT_VERIFICATION_KEYS` (PEM files) and `JWT_PREVIOUS_SECRETS`.
+func jwtKeys(cfg *config.Config) *jwt.KeySet {
+	keys := []*jwt.Key{}
+
+	parseKey := func(path string) *jwt.Key {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			panic(fmt.Errorf("failed to read jwt key: %w", err))
+		}
+
+		key, err := jwt.ParseKey(data)
+		if err != nil {
+			panic(fmt.Errorf("failed to parse jwt key %s: %w", path, err))
+		}
+		return key
+	}
+
+	if path := cfg.JwtSigningKey; len(path) > 0 {
+		keys = append(keys, parseKey(path))
+	}
+
+	if secret := cfg.JwtSecret; len(secret) > 0 {
+		keys = append(keys, jwt.NewHMACKey(secret))
+	}
+
+	for _, secret := range cfg.JwtPreviousSecrets {
+		keys = append(keys, jwt.NewHMACKey(secret))
+	}
+
+	for _, path := range cfg.JwtVerificationKeys {
+		keys = append(keys, parseKey(path))
+	}
+
+	if len(keys) == 0 {
+		return nil
+	}
+
+	keySet, err := jwt.NewKeySet(keys[0], keys[1:]...)
+	if err != nil {
+		panic(err)
 	}
+	return keySet
+}
 
-	return slog.New(slog.NewTextHandler(os.Stderr, opts))
+// NewLogger writes JSON or text records at the configured level
+func NewLogger(cfg *config.Config) *slog.Logger {
+	return logging.New(os.Stderr, cfg.Level(), cfg.LogFormat == "json", replaceAttr)
 }
 
 func replaceAttr(groups []string, a slog.Attr) slog.Attr {
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/repository"
+	"github.com/google/uuid"
+)
+
+func TestRun(t *testing.T) {
+	var called string
+	var passed []string
+	command := func(name string) func([]string) int {
+		return func(args []string) int {
+			called, passed = name, args
+			return 0
+		}
+	}
+
+	original := commands
+	t.Cleanup(func() { commands = original })
+	commands = map[string]func([]string) int{
+		"migrate":       command("migrate"),
+		"users promote": command("users promote"),
+	}
+
+	tests := []struct {
+		args   []string
+		code   int
+		called string
+		passed []string
+	}{
+		{args: []string{"migrate", "up"}, called: "migrate", passed: []string{"up"}},
+		{args: []string{"users", "promote", "42", "-role", "admin"}, called: "users promote", passed: []string{"42", "-role", "admin"}},
+		{args: []string{"users"}, code: 2},
+		{args: []string{"unknown"}, code: 2},
+		{args: []string{"help"}, code: 0},
+	}
+
+	for _, tt := range tests {
+		called, passed = "", nil
+		if code := run(tt.args); code != tt.code {
+			t.Errorf("%v: expected code %d, got %d", tt.args, tt.code, code)
+		}
+		if called != tt.called || !slices.Equal(passed, tt.passed) {
+			t.Errorf("%v: expected %q with %v, got %q with %v", tt.args, tt.called, tt.passed, called, passed)
+		}
+	}
+}
+
+func TestWriteEntries(t *testing.T) {
+	now := time.Date(2013, 8, 14, 22, 0, 0, 0, time.UTC)
+	entries := []repository.WaitlistEntry{{
+		ID:          uuid.MustParse("0198a3e4-7b1c-7c3e-9a6f-1d2e3f4a5b6c"),
+		UserID:      11,
+		FirstName:   "=HYPERLINK(\"https://example.com\")",
+		LastName:    "-person",
+		Username:    "ilovecats",
+		BotUsername: "waitlist_bot",
+		Message:     "@everyone +1",
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}}
+
+	t.Run("it escapes formulas in csv", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeEntries(&buf, entries, "csv"); err != nil {
+			t.Fatal(err)
+		}
+
+		records, err := csv.NewReader(&buf).ReadAll()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		expected := []string{
+			"0198a3e4-7b1c-7c3e-9a6f-1d2e3f4a5b6c", "11", "'=HYPERLINK(\"https://example.com\")", "'-person", "ilovecats", "waitlist_bot",
+			"'@everyone +1", "2013-08-14T22:00:00Z", "2013-08-14T22:00:00Z", "false", "",
+		}
+		if len(records) != 2 || !slices.Equal(records[1], expected) {
+			t.Errorf("expected %q, got %q", expected, records)
+		}
+	})
+
+	t.Run("it keeps json as is", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeEntries(&buf, entries, "json"); err != nil {
+			t.Fatal(err)
+		}
+
+		var decoded []repository.WaitlistEntry
+		if err := json.Unmarshal(buf.Bytes(), &decoded); err != nil {
+			t.Fatal(err)
+		}
+		if len(decoded) != 1 || decoded[0].FirstName != entries[0].FirstName {
+			t.Errorf("expected %v, got %v", entries, decoded)
+		}
+	})
+
+	t.Run("it writes empty json array", func(t *testing.T) {
+		var buf bytes.Buffer
+		if err := writeEntries(&buf, nil, "json"); err != nil {
+			t.Fatal(err)
+		}
+		if buf.String() != "[]\n" {
+			t.Errorf("expected empty array, got %q", buf.String())
+		}
+	})
+}
+
+func TestTelegramID(t *testing.T) {
+	tests := []struct {
+		args []string
+		id   int64
+		ok   bool
+	}{
+		{args: []string{"42"}, id: 42, ok: true},
+		{args: []string{}, ok: false},
+		{args: []string{"42", "43"}, ok: false},
+		{args: []string{"cat"}, ok: false},
+	}
+
+	for _, tt := range tests {
+		if id, ok := telegramID(tt.args); id != tt.id || ok != tt.ok {
+			t.Errorf("%v: expected %d %t, got %d %t", tt.args, tt.id, tt.ok, id, ok)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+
+	"github.com/ailinykh/waitlist/internal/config"
+	"github.com/ailinykh/waitlist/internal/database"
+)
+
+const migrateUsage = `usage: waitlist migrate [flags] <command>
+
+commands:
+  up         apply all pending migrations
+  down N     roll back N most recent migrations
+  status     print schema version and pending migrations
+  force V    set schema version to V and clear the dirty flag`
+
+// migrateCommand manages the schema with the embedded migrations, see `database.Migrator`
+func migrateCommand(args []string) int {
+	cfg := loadConfig(args, (*config.Config).ValidateDatabase)
+	logger := NewLogger(cfg)
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	migrator := database.NewMigrator(cfg.DatabaseURL, migrations, logger)
+
+	args = cfg.Args()
+	if len(args) == 0 {
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	number := func() (int, bool) {
+		if len(args) != 2 {
+			return 0, false
+		}
+		n, err := strconv.Atoi(args[1])
+		return n, err == nil
+	}
+
+	var err error
+	switch args[0] {
+	case "up":
+		err = migrator.Up(ctx)
+	case "down":
+		n, ok := number()
+		if !ok {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		err = migrator.Down(ctx, n)
+	case "force":
+		v, ok := number()
+		if !ok {
+			fmt.Fprintln(os.Stderr, migrateUsage)
+			return 2
+		}
+		err = migrator.Force(ctx, v)
+	case "status":
+		var status database.MigrationStatus
+		status, err = migrator.Status(ctx)
+		if err == nil {
+			printStatus(status)
+		}
+	default:
+		fmt.Fprintln(os.Stderr, migrateUsage)
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	return 0
+}
+
+func printStatus(status database.MigrationStatus) {
+	fmt.Printf("version: %d\n", status.Version)
+	fmt.Printf("dirty:   %t\n", status.Dirty)
+	fmt.Printf("latest:  %d\n", status.Latest)
+
+	pending := []string{}
+	for _, v := range status.Pending {
+		pending = append(pending, strconv.FormatUint(uint64(v), 10))
+	}
+	fmt.Printf("pending: %s\n", strings.Join(pending, ", "))
+}
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS active BOOLEAN NOT NULL DEFAULT TRUE;
+
+CREATE TABLE IF NOT EXISTS role_changes (
+  id UUID PRIMARY KEY DEFAULT uuidv7(),
+  user_id BIGINT NOT NULL,
+  old_role TEXT NOT NULL,
+  new_role TEXT NOT NULL,
+  changed_by BIGINT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
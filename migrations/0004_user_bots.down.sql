@@ -0,0 +1,3 @@
+DROP INDEX IF EXISTS waitlist_bot_username_idx;
+
+DROP TABLE IF EXISTS user_bots;
\ No newline at end of file
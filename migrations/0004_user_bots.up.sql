@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS user_bots (
+  user_id BIGINT NOT NULL,
+  bot_username TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (user_id, bot_username)
+);
+
+CREATE INDEX IF NOT EXISTS waitlist_bot_username_idx ON waitlist (bot_username);
\ No newline at end of file
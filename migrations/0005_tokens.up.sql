@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+  id UUID PRIMARY KEY DEFAULT uuidv7(),
+  user_id BIGINT NOT NULL,
+  token_hash TEXT NOT NULL UNIQUE,
+  expires_at TIMESTAMP NOT NULL,
+  revoked_at TIMESTAMP,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE IF NOT EXISTS token_revocations (
+  id UUID PRIMARY KEY DEFAULT uuidv7(),
+  user_id BIGINT NOT NULL,
+  revoked_at TIMESTAMP NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS token_revocations_user_id_idx ON token_revocations (user_id, revoked_at);
\ No newline at end of file
@@ -0,0 +1,21 @@
+DROP VIEW IF EXISTS waitlist_entries;
+
+DROP INDEX IF EXISTS waitlist_user_id_idx;
+
+ALTER TABLE waitlist
+  DROP CONSTRAINT IF EXISTS waitlist_user_id_fkey,
+  ADD COLUMN first_name TEXT NOT NULL DEFAULT '',
+  ADD COLUMN last_name TEXT NOT NULL DEFAULT '',
+  ADD COLUMN username TEXT NOT NULL DEFAULT '';
+
+UPDATE waitlist w
+SET first_name = u.first_name, last_name = u.last_name, username = u.username
+FROM users u
+WHERE u.user_id = w.user_id;
+
+ALTER TABLE waitlist
+  ALTER COLUMN first_name DROP DEFAULT,
+  ALTER COLUMN last_name DROP DEFAULT,
+  ALTER COLUMN username DROP DEFAULT;
+
+DROP INDEX IF EXISTS users_user_id_key;
\ No newline at end of file
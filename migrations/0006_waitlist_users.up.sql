@@ -0,0 +1,22 @@
+DELETE FROM users a USING users b WHERE a.user_id = b.user_id AND a.id > b.id;
+
+CREATE UNIQUE INDEX IF NOT EXISTS users_user_id_key ON users (user_id);
+
+INSERT INTO users (user_id, first_name, last_name, username, photo_url, role)
+SELECT DISTINCT ON (user_id) user_id, first_name, last_name, username, '', 'user'
+FROM waitlist
+ORDER BY user_id, created_at DESC
+ON CONFLICT (user_id) DO NOTHING;
+
+ALTER TABLE waitlist
+  DROP COLUMN first_name,
+  DROP COLUMN last_name,
+  DROP COLUMN username,
+  ADD CONSTRAINT waitlist_user_id_fkey FOREIGN KEY (user_id) REFERENCES users (user_id);
+
+CREATE INDEX IF NOT EXISTS waitlist_user_id_idx ON waitlist (user_id);
+
+CREATE OR REPLACE VIEW waitlist_entries AS
+SELECT w.id, w.user_id, u.first_name, u.last_name, u.username, w.bot_username, w.message, w.created_at, w.updated_at
+FROM waitlist w
+JOIN users u ON u.user_id = w.user_id;
\ No newline at end of file
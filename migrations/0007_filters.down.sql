@@ -0,0 +1,16 @@
+DROP TABLE IF EXISTS blocked_users;
+
+DROP TABLE IF EXISTS banned_words;
+
+DROP INDEX IF EXISTS waitlist_user_id_bot_username_created_at_idx;
+
+DROP VIEW IF EXISTS waitlist_entries;
+
+ALTER TABLE waitlist
+  DROP COLUMN IF EXISTS flagged,
+  DROP COLUMN IF EXISTS flag_reason;
+
+CREATE VIEW waitlist_entries AS
+SELECT w.id, w.user_id, u.first_name, u.last_name, u.username, w.bot_username, w.message, w.created_at, w.updated_at
+FROM waitlist w
+JOIN users u ON u.user_id = w.user_id;
\ No newline at end of file
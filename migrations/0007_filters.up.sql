@@ -0,0 +1,24 @@
+ALTER TABLE waitlist
+  ADD COLUMN IF NOT EXISTS flagged BOOLEAN NOT NULL DEFAULT FALSE,
+  ADD COLUMN IF NOT EXISTS flag_reason TEXT NOT NULL DEFAULT '';
+
+CREATE OR REPLACE VIEW waitlist_entries AS
+SELECT w.id, w.user_id, u.first_name, u.last_name, u.username, w.bot_username, w.message, w.created_at, w.updated_at, w.flagged, w.flag_reason
+FROM waitlist w
+JOIN users u ON u.user_id = w.user_id;
+
+CREATE INDEX IF NOT EXISTS waitlist_user_id_bot_username_created_at_idx ON waitlist (user_id, bot_username, created_at);
+
+CREATE TABLE IF NOT EXISTS banned_words (
+  bot_username TEXT NOT NULL,
+  word TEXT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+  PRIMARY KEY (bot_username, word)
+);
+
+CREATE TABLE IF NOT EXISTS blocked_users (
+  user_id BIGINT PRIMARY KEY,
+  reason TEXT NOT NULL,
+  blocked_by BIGINT NOT NULL,
+  created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
\ No newline at end of file
@@ -0,0 +1,6 @@
+CREATE TABLE IF NOT EXISTS login_payloads (
+  hash TEXT PRIMARY KEY,
+  expires_at TIMESTAMP NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS login_payloads_expires_at_idx ON login_payloads (expires_at);
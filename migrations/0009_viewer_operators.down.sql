@@ -0,0 +1 @@
+-- former operators can not be told apart from viewers, nothing to restore
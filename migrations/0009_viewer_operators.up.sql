@@ -0,0 +1,2 @@
+-- operators could do nothing viewers could not, the role is gone
+UPDATE users SET role = 'viewer' WHERE role = 'operator';
@@ -2,6 +2,7 @@ package httptest
 
 import (
 	"bytes"
+	"encoding/json"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -57,6 +58,7 @@ func (r *request) ToRespond(opts ...func(*response)) {
 		code:        http.StatusOK,
 		contentType: "",
 		cookies:     make(map[string]*string),
+		headers:     make(map[string]string),
 	}
 	for _, opt := range opts {
 		opt(expected)
@@ -93,6 +95,12 @@ func (r *request) ToRespond(opts ...func(*response)) {
 		}
 	}
 
+	for key, value := range expected.headers {
+		if actual := response.Header().Get(key); actual != value {
+			r.t.Errorf("expected '%s' header to be: '%s', got '%s'", key, value, actual)
+		}
+	}
+
 	if len(expected.contentType) > 0 {
 		contentType := response.Header().Get("Content-Type")
 		if contentType != expected.contentType {
@@ -100,7 +108,7 @@ func (r *request) ToRespond(opts ...func(*response)) {
 		}
 	}
 
-	if expected.body != nil {
+	if expected.body != nil || expected.decode != nil {
 		res := response.Result()
 		defer res.Body.Close()
 		data, err := io.ReadAll(res.Body)
@@ -108,8 +116,14 @@ func (r *request) ToRespond(opts ...func(*response)) {
 			r.t.Errorf("unexpected body %s", err)
 		}
 		// `json.Encoder` writes some spaces and new line at the end
-		if string(expected.body) != strings.TrimSpace(string(data)) {
+		if expected.body != nil && string(expected.body) != strings.TrimSpace(string(data)) {
 			r.t.Errorf("expected '%s' but got '%s'", expected.body, data)
 		}
+
+		if expected.decode != nil {
+			if err := json.Unmarshal(data, expected.decode); err != nil {
+				r.t.Errorf("failed to decode '%s': %s", data, err)
+			}
+		}
 	}
 }
@@ -4,7 +4,9 @@ type response struct {
 	code        int
 	contentType string
 	cookies     map[string]*string
+	headers     map[string]string
 	body        []byte
+	decode      any
 }
 
 func WithCode(code int) func(*response) {
@@ -25,6 +27,12 @@ func WithCookie(key string, values ...string) func(*response) {
 	}
 }
 
+func WithResponseHeader(key, value string) func(*response) {
+	return func(resp *response) {
+		resp.headers[key] = value
+	}
+}
+
 func WithContentType(contentType string) func(*response) {
 	return func(resp *response) {
 		resp.contentType = contentType
@@ -36,3 +44,10 @@ func WithBody(body []byte) func(*response) {
 		resp.body = body
 	}
 }
+
+// DecodeJSON unmarshals the response body into `v`
+func DecodeJSON(v any) func(*response) {
+	return func(resp *response) {
+		resp.decode = v
+	}
+}
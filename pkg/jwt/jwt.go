@@ -2,31 +2,107 @@ package jwt
 
 import (
 	"fmt"
+	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 )
 
-func Encode(secret string, claims map[string]interface{}) (string, error) {
-	clms := jwt.MapClaims{}
-	for k, v := range claims {
-		clms[k] = v
+var ErrTokenExpired = jwt.ErrTokenExpired
+
+type RegisteredClaims = jwt.RegisteredClaims
+
+// Claims combines standard registered claims with an application specific payload
+type Claims[T any] struct {
+	jwt.RegisteredClaims
+	Payload T `json:"payload"`
+}
+
+// NewNumericDate truncates the time to `jwt.TimePrecision` as it gets encoded
+func NewNumericDate(t time.Time) *jwt.NumericDate {
+	return jwt.NewNumericDate(t)
+}
+
+type Clock interface {
+	Now() time.Time
+}
+
+type Validation struct {
+	clock    Clock
+	issuer   string
+	audience string
+}
+
+func WithClock(clock Clock) func(*Validation) {
+	return func(v *Validation) {
+		v.clock = clock
 	}
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, clms)
-	return token.SignedString([]byte(secret))
 }
 
-func Decode(hash, secret string) (map[string]interface{}, error) {
-	token, err := jwt.Parse(hash, func(t *jwt.Token) (interface{}, error) {
-		return []byte(secret), nil
-	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+func WithIssuer(issuer string) func(*Validation) {
+	return func(v *Validation) {
+		v.issuer = issuer
+	}
+}
 
-	if err != nil {
-		return nil, fmt.Errorf("failed to parse jwt token: %w", err)
+func WithAudience(audience string) func(*Validation) {
+	return func(v *Validation) {
+		v.audience = audience
 	}
+}
+
+// Encode signs claims with HS256 secret
+func Encode[T any](secret string, claims *Claims[T]) (string, error) {
+	keys, _ := NewKeySet(NewHMACKey(secret))
+	return Sign(keys, claims)
+}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok {
-		return claims, nil
+// Decode verifies HS256 signed token, see `Verify`
+func Decode[T any](hash, secret string, opts ...func(*Validation)) (*Claims[T], error) {
+	keys, _ := NewKeySet(NewHMACKey(secret))
+	return Verify[T](hash, keys, opts...)
+}
+
+// Sign signs claims with the signing key of the set and puts its `kid` into the header
+func Sign[T any](keys *KeySet, claims *Claims[T]) (string, error) {
+	token := jwt.NewWithClaims(keys.signing.method, claims)
+	if len(keys.signing.ID) > 0 {
+		token.Header["kid"] = keys.signing.ID
+	}
+	return token.SignedString(keys.signing.signKey)
+}
+
+// Verify checks the signature against the keys of the set and validates `exp`, `nbf`, `iat`
+// and optionally `iss` and `aud` claims
+func Verify[T any](hash string, keys *KeySet, opts ...func(*Validation)) (*Claims[T], error) {
+	v := &Validation{}
+	for _, opt := range opts {
+		opt(v)
+	}
+
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(keys.methods()),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	}
+
+	if v.clock != nil {
+		options = append(options, jwt.WithTimeFunc(v.clock.Now))
+	}
+
+	if len(v.issuer) > 0 {
+		options = append(options, jwt.WithIssuer(v.issuer))
+	}
+
+	if len(v.audience) > 0 {
+		options = append(options, jwt.WithAudience(v.audience))
+	}
+
+	claims := &Claims[T]{}
+	_, err := jwt.ParseWithClaims(hash, claims, keys.keyfunc, options...)
+
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse jwt token: %w", err)
 	}
 
-	return nil, fmt.Errorf("failed to parse jwt claims")
+	return claims, nil
 }
@@ -0,0 +1,159 @@
+package jwt_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/ailinykh/waitlist/pkg/jwt"
+)
+
+type payload struct {
+	Name string `json:"name"`
+}
+
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time {
+	return time.Time(c)
+}
+
+func TestEncodeDecode(t *testing.T) {
+	now := time.Date(2013, 8, 14, 22, 0, 0, 0, time.UTC)
+	token, err := jwt.Encode("secret", &jwt.Claims[payload]{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "waitlist",
+			Subject:   "11",
+			Audience:  []string{"waitlist"},
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+			ID:        "jti",
+		},
+		Payload: payload{Name: "cat"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("it decodes typed payload", func(t *testing.T) {
+		claims, err := jwt.Decode[payload](token, "secret",
+			jwt.WithClock(fixedClock(now)),
+			jwt.WithIssuer("waitlist"),
+			jwt.WithAudience("waitlist"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if claims.Payload.Name != "cat" || claims.Subject != "11" || claims.ID != "jti" {
+			t.Errorf("unexpected claims %v", claims)
+		}
+	})
+
+	t.Run("it validates expiration against the clock", func(t *testing.T) {
+		_, err := jwt.Decode[payload](token, "secret", jwt.WithClock(fixedClock(now.Add(time.Hour))))
+		if !errors.Is(err, jwt.ErrTokenExpired) {
+			t.Errorf("expected expired token error, got %v", err)
+		}
+	})
+
+	t.Run("it validates issuer and audience", func(t *testing.T) {
+		if _, err := jwt.Decode[payload](token, "secret", jwt.WithClock(fixedClock(now)), jwt.WithIssuer("other")); err == nil {
+			t.Error("expected issuer mismatch")
+		}
+
+		if _, err := jwt.Decode[payload](token, "secret", jwt.WithClock(fixedClock(now)), jwt.WithAudience("other")); err == nil {
+			t.Error("expected audience mismatch")
+		}
+	})
+
+	t.Run("it validates signature", func(t *testing.T) {
+		if _, err := jwt.Decode[payload](token, "wrong", jwt.WithClock(fixedClock(now))); err == nil {
+			t.Error("expected signature mismatch")
+		}
+	})
+}
+
+func TestKeyRotation(t *testing.T) {
+	now := time.Date(2013, 8, 14, 22, 0, 0, 0, time.UTC)
+	claims := &jwt.Claims[payload]{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(now.Add(time.Minute)),
+		},
+		Payload: payload{Name: "cat"},
+	}
+
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	old, _ := jwt.NewKeySet(jwt.NewHMACKey("secret"))
+	hmacToken, err := jwt.Sign(old, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current, _ := jwt.NewKeySet(jwt.NewEdDSAKey(edKey), jwt.NewHMACKey("secret"))
+	edToken, err := jwt.Sign(current, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := x509.MarshalPKIXPublicKey(edKey.Public())
+	if err != nil {
+		t.Fatal(err)
+	}
+	edPublicKey, err := jwt.ParseKey(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: data}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, _ := jwt.NewKeySet(jwt.NewRSAKey(rsaKey), edPublicKey)
+	rsaToken, err := jwt.Sign(next, claims)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("it verifies tokens signed by previous keys", func(t *testing.T) {
+		for _, token := range []string{hmacToken, edToken} {
+			if _, err := jwt.Verify[payload](token, current, jwt.WithClock(fixedClock(now))); err != nil {
+				t.Errorf("expected token to be verified, got %s", err)
+			}
+		}
+
+		for _, token := range []string{edToken, rsaToken} {
+			if _, err := jwt.Verify[payload](token, next, jwt.WithClock(fixedClock(now))); err != nil {
+				t.Errorf("expected token to be verified, got %s", err)
+			}
+		}
+	})
+
+	t.Run("it rejects tokens signed by removed keys", func(t *testing.T) {
+		if _, err := jwt.Verify[payload](hmacToken, next, jwt.WithClock(fixedClock(now))); err == nil {
+			t.Error("expected hmac token to be rejected")
+		}
+	})
+
+	t.Run("it publishes public keys only", func(t *testing.T) {
+		jwks := current.JWKS()
+		if len(jwks.Keys) != 1 || jwks.Keys[0].Kty != "OKP" || jwks.Keys[0].Kid != edPublicKey.ID {
+			t.Errorf("unexpected jwks %v", jwks)
+		}
+
+		jwks = next.JWKS()
+		if len(jwks.Keys) != 2 || jwks.Keys[0].Alg != "RS256" || jwks.Keys[1].Alg != "EdDSA" {
+			t.Errorf("unexpected jwks %v", jwks)
+		}
+	})
+}
@@ -0,0 +1,257 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"log/slog"
+	"math/big"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// Key is a signing and/or verification key identified by `kid` header
+type Key struct {
+	ID        string
+	method    jwt.SigningMethod
+	signKey   any
+	verifyKey any
+}
+
+// NewHMACKey creates HS256 key. HMAC keys have no `kid`, so tokens signed by previous secrets
+// are verified by trying every HMAC key of the set.
+func NewHMACKey(secret string) *Key {
+	return &Key{
+		method:    jwt.SigningMethodHS256,
+		signKey:   []byte(secret),
+		verifyKey: []byte(secret),
+	}
+}
+
+// NewEdDSAKey creates EdDSA key identified by its RFC 7638 thumbprint
+func NewEdDSAKey(key ed25519.PrivateKey) *Key {
+	k := NewEdDSAPublicKey(key.Public().(ed25519.PublicKey))
+	k.signKey = key
+	return k
+}
+
+// NewEdDSAPublicKey creates verification only EdDSA key
+func NewEdDSAPublicKey(key ed25519.PublicKey) *Key {
+	k := &Key{
+		method:    jwt.SigningMethodEdDSA,
+		verifyKey: key,
+	}
+	k.ID = k.thumbprint()
+	return k
+}
+
+// NewRSAKey creates RS256 key identified by its RFC 7638 thumbprint
+func NewRSAKey(key *rsa.PrivateKey) *Key {
+	k := NewRSAPublicKey(&key.PublicKey)
+	k.signKey = key
+	return k
+}
+
+// NewRSAPublicKey creates verification only RS256 key
+func NewRSAPublicKey(key *rsa.PublicKey) *Key {
+	k := &Key{
+		method:    jwt.SigningMethodRS256,
+		verifyKey: key,
+	}
+	k.ID = k.thumbprint()
+	return k
+}
+
+// ParseKey parses PEM encoded Ed25519 or RSA key, either private (PKCS #8 or PKCS #1) or public (PKIX)
+func ParseKey(data []byte) (*Key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("failed to decode pem block")
+	}
+
+	var key any
+	var err error
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "RSA PRIVATE KEY":
+		key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		key, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported pem block type: %s", block.Type)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse key: %w", err)
+	}
+
+	switch k := key.(type) {
+	case ed25519.PrivateKey:
+		return NewEdDSAKey(k), nil
+	case ed25519.PublicKey:
+		return NewEdDSAPublicKey(k), nil
+	case *rsa.PrivateKey:
+		return NewRSAKey(k), nil
+	case *rsa.PublicKey:
+		return NewRSAPublicKey(k), nil
+	default:
+		return nil, fmt.Errorf("unsupported key type: %T", key)
+	}
+}
+
+func (k *Key) Alg() string {
+	return k.method.Alg()
+}
+
+// JWK returns public part of the key, HMAC keys are never exposed
+func (k *Key) JWK() (JWK, bool) {
+	switch key := k.verifyKey.(type) {
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(key),
+			Kid: k.ID,
+			Alg: k.Alg(),
+			Use: "sig",
+		}, true
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+			Kid: k.ID,
+			Alg: k.Alg(),
+			Use: "sig",
+		}, true
+	default:
+		return JWK{}, false
+	}
+}
+
+// thumbprint calculates RFC 7638 JWK thumbprint
+func (k *Key) thumbprint() string {
+	jwk, ok := k.JWK()
+	if !ok {
+		return ""
+	}
+
+	// required members only, in lexicographic order
+	var members any
+	switch jwk.Kty {
+	case "OKP":
+		members = struct {
+			Crv string `json:"crv"`
+			Kty string `json:"kty"`
+			X   string `json:"x"`
+		}{jwk.Crv, jwk.Kty, jwk.X}
+	case "RSA":
+		members = struct {
+			E   string `json:"e"`
+			Kty string `json:"kty"`
+			N   string `json:"n"`
+		}{jwk.E, jwk.Kty, jwk.N}
+	}
+
+	data, _ := json.Marshal(members)
+	sum := sha256.Sum256(data)
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+}
+
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeySet signs tokens with a single key and verifies them with any of the active keys,
+// so the signing key can be rotated without logging everyone out
+type KeySet struct {
+	signing *Key
+	keys    []*Key
+}
+
+func NewKeySet(signing *Key, verification ...*Key) (*KeySet, error) {
+	if signing == nil || signing.signKey == nil {
+		return nil, fmt.Errorf("signing key must contain private part")
+	}
+
+	return &KeySet{
+		signing: signing,
+		keys:    append([]*Key{signing}, verification...),
+	}, nil
+}
+
+// Signing returns the key new tokens are signed with
+func (ks *KeySet) Signing() *Key {
+	return ks.signing
+}
+
+// JWKS returns public keys of the set for publishing at `/.well-known/jwks.json`
+func (ks *KeySet) JWKS() JWKS {
+	jwks := JWKS{Keys: []JWK{}}
+	for _, k := range ks.keys {
+		if jwk, ok := k.JWK(); ok {
+			jwks.Keys = append(jwks.Keys, jwk)
+		}
+	}
+	return jwks
+}
+
+func (ks *KeySet) LogValue() slog.Value {
+	kids := []string{}
+	for _, k := range ks.keys {
+		kids = append(kids, k.Alg()+":"+k.ID)
+	}
+	return slog.GroupValue(
+		slog.String("signing", ks.signing.Alg()+":"+ks.signing.ID),
+		slog.Any("verification", kids),
+	)
+}
+
+func (ks *KeySet) methods() []string {
+	methods := []string{}
+	for _, k := range ks.keys {
+		methods = append(methods, k.Alg())
+	}
+	return methods
+}
+
+func (ks *KeySet) keyfunc(t *jwt.Token) (interface{}, error) {
+	kid, _ := t.Header["kid"].(string)
+
+	set := jwt.VerificationKeySet{}
+	for _, k := range ks.keys {
+		if k.Alg() != t.Method.Alg() {
+			continue
+		}
+
+		if len(kid) > 0 && k.ID == kid {
+			return k.verifyKey, nil
+		}
+
+		if len(kid) == 0 {
+			set.Keys = append(set.Keys, k.verifyKey)
+		}
+	}
+
+	if len(set.Keys) == 0 {
+		return nil, fmt.Errorf("unknown signing key: %q", kid)
+	}
+
+	return set, nil
+}
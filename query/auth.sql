@@ -0,0 +1,34 @@
+-- name: CreateRefreshToken :execresult
+INSERT INTO refresh_tokens (user_id, token_hash, expires_at)
+VALUES ($1, $2, $3);
+
+-- name: GetRefreshTokenByHash :one
+SELECT * FROM refresh_tokens WHERE token_hash = $1;
+
+-- name: RevokeRefreshToken :execresult
+UPDATE refresh_tokens SET revoked_at = $2 WHERE id = $1 AND revoked_at IS NULL;
+
+-- name: RevokeUserRefreshTokens :execresult
+UPDATE refresh_tokens SET revoked_at = $2 WHERE user_id = $1 AND revoked_at IS NULL;
+
+-- name: CreateTokenRevocation :execresult
+INSERT INTO token_revocations (user_id, revoked_at)
+VALUES ($1, $2);
+
+-- name: IsTokenRevoked :one
+-- `iat` claim has whole seconds only, so tokens issued in the second of the revocation are kept
+SELECT EXISTS(
+  SELECT 1 FROM token_revocations WHERE user_id = $1 AND date_trunc('second', revoked_at) > $2
+);
+-- name: ClaimLoginPayload :execresult
+-- the payload is claimed unless another claim of it is still valid
+INSERT INTO login_payloads (hash, expires_at)
+VALUES (@hash, @expires_at)
+ON CONFLICT (hash) DO UPDATE SET expires_at = EXCLUDED.expires_at
+WHERE login_payloads.expires_at <= @now;
+
+-- name: ReleaseLoginPayload :execresult
+DELETE FROM login_payloads WHERE hash = $1;
+
+-- name: DeleteExpiredLoginPayloads :execresult
+DELETE FROM login_payloads WHERE expires_at <= $1;
@@ -0,0 +1,30 @@
+-- name: CountRepeatedEntries :one
+SELECT COUNT(*) FROM waitlist
+WHERE user_id = $1 AND bot_username = $2 AND message = $3 AND created_at > $4;
+
+-- name: GetBannedWords :many
+SELECT word FROM banned_words WHERE bot_username = $1 ORDER BY word;
+
+-- name: CreateBannedWord :execresult
+INSERT INTO banned_words (bot_username, word)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteBannedWord :execresult
+DELETE FROM banned_words WHERE bot_username = $1 AND word = $2;
+
+-- name: GetBlockedUsers :many
+SELECT * FROM blocked_users ORDER BY created_at;
+
+-- name: IsUserBlocked :one
+SELECT EXISTS(
+  SELECT 1 FROM blocked_users WHERE user_id = $1
+);
+
+-- name: CreateBlockedUser :execresult
+INSERT INTO blocked_users (user_id, reason, blocked_by)
+VALUES ($1, $2, $3)
+ON CONFLICT (user_id) DO UPDATE SET reason = EXCLUDED.reason, blocked_by = EXCLUDED.blocked_by;
+
+-- name: DeleteBlockedUser :execresult
+DELETE FROM blocked_users WHERE user_id = $1;
\ No newline at end of file
@@ -0,0 +1,34 @@
+-- name: UpdateUserRole :execresult
+UPDATE users SET role = $2, updated_at = NOW() WHERE user_id = $1;
+
+-- name: UpdateUserActive :execresult
+UPDATE users SET active = $2, updated_at = NOW() WHERE user_id = $1;
+
+-- name: CreateRoleChange :execresult
+INSERT INTO role_changes (user_id, old_role, new_role, changed_by)
+VALUES ($1, $2, $3, $4);
+
+-- name: GetRoleChangesByUserID :many
+SELECT * FROM role_changes WHERE user_id = $1 ORDER BY created_at;
+
+-- name: GetUserBots :many
+SELECT bot_username FROM user_bots WHERE user_id = $1 ORDER BY bot_username;
+
+-- name: CreateUserBot :execresult
+INSERT INTO user_bots (user_id, bot_username)
+VALUES ($1, $2)
+ON CONFLICT DO NOTHING;
+
+-- name: DeleteUserBot :execresult
+DELETE FROM user_bots WHERE user_id = $1 AND bot_username = $2;
+
+-- name: UpsertUser :one
+INSERT INTO users (user_id, first_name, last_name, username, photo_url, role)
+VALUES ($1, $2, $3, $4, $5, $6)
+ON CONFLICT (user_id) DO UPDATE SET
+  first_name = EXCLUDED.first_name,
+  last_name = EXCLUDED.last_name,
+  username = EXCLUDED.username,
+  photo_url = CASE WHEN EXCLUDED.photo_url = '' THEN users.photo_url ELSE EXCLUDED.photo_url END,
+  updated_at = NOW()
+RETURNING *;
\ No newline at end of file
@@ -1,12 +1,18 @@
 -- name: GetAllEntries :many
-SELECT * FROM waitlist;
+SELECT * FROM waitlist_entries;
+
+-- name: GetEntriesByBotUsernames :many
+SELECT * FROM waitlist_entries WHERE bot_username = ANY(@bot_usernames::text[]);
+
+-- name: GetEntriesByUserID :many
+SELECT * FROM waitlist_entries WHERE user_id = $1;
 
 -- name: GetEntryByID :one
-SELECT * FROM waitlist WHERE id = $1;
+SELECT * FROM waitlist_entries WHERE id = $1;
 
 -- name: CreateEntry :execresult
-INSERT INTO waitlist (user_id, first_name, last_name, username, bot_username, message)
-VALUES ($1, $2, $3, $4, $5, $6);
+INSERT INTO waitlist (user_id, bot_username, message, flagged, flag_reason)
+VALUES ($1, $2, $3, $4, $5);
 
 
 -- name: GetAllUsers :many
@@ -14,7 +20,3 @@ SELECT * FROM users;
 
 -- name: GetUserByUserID :one
 SELECT * FROM users WHERE user_id = $1;
-
--- name: CreateUser :execresult
-INSERT INTO users (user_id, first_name, last_name, username, photo_url, role)
-VALUES ($1, $2, $3, $4, $5, 'user');
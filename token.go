@@ -0,0 +1,57 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/app"
+	"github.com/ailinykh/waitlist/internal/config"
+	"github.com/ailinykh/waitlist/internal/repository"
+)
+
+const tokenUsage = `usage: waitlist token issue [flags] <telegram_id>`
+
+// tokenCommand prints an access token of an existing user, e.g. for scripts calling the API.
+// It is signed with the same keys the server uses and carries the user current role.
+func tokenCommand(args []string) int {
+	ttl := time.Hour
+	cfg := loadConfig(args, func(c *config.Config) error {
+		return errors.Join(c.ValidateDatabase(), c.ValidateJwt())
+	}, func(fs *flag.FlagSet) {
+		fs.DurationVar(&ttl, "ttl", ttl, "token lifetime")
+	})
+
+	userID, ok := telegramID(cfg.Args())
+	if !ok || ttl <= 0 {
+		fmt.Fprintln(os.Stderr, tokenUsage)
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	logger := NewLogger(cfg)
+	conn, err := db(logger, cfg, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+
+	token, err := app.IssueAccessToken(ctx, repository.New(conn), userID,
+		app.WithJwtKeys(jwtKeys(cfg)),
+		app.WithAccessTokenTTL(ttl),
+	)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Println(token)
+	return 0
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"os/signal"
+	"strconv"
+	"time"
+
+	"github.com/ailinykh/waitlist/internal/app"
+	"github.com/ailinykh/waitlist/internal/config"
+	"github.com/ailinykh/waitlist/internal/permission"
+	"github.com/ailinykh/waitlist/internal/repository"
+)
+
+const promoteUsage = `usage: waitlist users promote [flags] <telegram_id>`
+
+// promoteCommand changes the role of a user who has logged in at least once,
+// the change is recorded in the audit log as made by the system
+func promoteCommand(args []string) int {
+	role := permission.RoleAdmin
+	cfg := loadConfig(args, (*config.Config).ValidateDatabase, func(fs *flag.FlagSet) {
+		fs.StringVar(&role, "role", role, "user, viewer or admin")
+	})
+
+	userID, ok := telegramID(cfg.Args())
+	if !ok {
+		fmt.Fprintln(os.Stderr, promoteUsage)
+		return 2
+	}
+
+	ctx, cancel := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer cancel()
+
+	logger := NewLogger(cfg)
+	conn, err := db(logger, cfg, false)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+	defer conn.Close()
+
+	repo := repository.New(conn)
+	user, err := repo.GetUserByUserID(ctx, userID)
+	if errors.Is(err, sql.ErrNoRows) {
+		fmt.Fprintf(os.Stderr, "user %d not found, the user has to login first\n", userID)
+		return 1
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	if user.Role == role {
+		fmt.Printf("user %d is already %s\n", userID, role)
+		return 0
+	}
+
+	if err := app.ChangeUserRole(ctx, repo, time.Now(), user, role, app.SystemUserID); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		return 1
+	}
+
+	fmt.Printf("user %d changed from %s to %s\n", userID, user.Role, role)
+	return 0
+}
+
+// telegramID expects exactly one positional argument with the Telegram user id
+func telegramID(args []string) (int64, bool) {
+	if len(args) != 1 {
+		return 0, false
+	}
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	return id, err == nil
+}
@@ -0,0 +1,3 @@
+// Package web holds the SPA, it is built into the binary with `-tags embedweb`
+// and read from `static_files_dir` otherwise
+package web
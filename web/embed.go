@@ -0,0 +1,22 @@
+//go:build embedweb
+
+package web
+
+import (
+	"embed"
+	"io/fs"
+)
+
+// `all:` keeps the `_app` directory, names starting with `_` are skipped otherwise
+//
+//go:embed all:build
+var build embed.FS
+
+// Build is the SPA built by `npm run build` before compiling with `-tags embedweb`
+var Build = func() fs.FS {
+	files, err := fs.Sub(build, "build")
+	if err != nil {
+		panic(err)
+	}
+	return files
+}()
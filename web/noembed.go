@@ -0,0 +1,8 @@
+//go:build !embedweb
+
+package web
+
+import "io/fs"
+
+// Build is nil unless compiled with `-tags embedweb`
+var Build fs.FS
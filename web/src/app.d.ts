@@ -10,6 +10,8 @@ declare global {
 			username: string;
 			message: string;
 			created_at: string;
+			flagged: boolean;
+			flag_reason: string;
 		}
 	}
 }
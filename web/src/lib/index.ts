@@ -1 +1,29 @@
 // place files you want to import through the `$lib` alias in this folder.
+
+// fetch wrapper which refreshes short-lived access token once it expired.
+// Tokens live in HttpOnly cookies, so state-changing requests have to echo CSRF cookie back in a header.
+export async function api(input: string, init: RequestInit = {}): Promise<Response> {
+	const res = await fetch(input, withCSRF(init));
+	if (res.status !== 401) {
+		return res;
+	}
+
+	const refreshed = await fetch('/api/auth/refresh', withCSRF({ method: 'POST' }));
+	if (!refreshed.ok) {
+		return res;
+	}
+
+	return fetch(input, withCSRF(init));
+}
+
+function withCSRF(init: RequestInit): RequestInit {
+	const csrf = document.cookie
+		.split('; ')
+		.find((c) => c.startsWith('csrf_token='))
+		?.split('=')[1];
+	return {
+		...init,
+		credentials: 'same-origin',
+		headers: { ...init.headers, 'X-CSRF-Token': csrf ?? '' }
+	};
+}